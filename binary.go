@@ -0,0 +1,218 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages and tserr
+import (
+	"bytes"          // bytes
+	"compress/flate" // flate
+	"compress/gzip"  // gzip
+	"fmt"            // fmt
+	"go/token"       // token
+	"io"             // io
+	"strings"        // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+)
+
+// Compression is the compression of the data of a literal generated by BinaryLit.
+type Compression int
+
+// Compressions of the data of a literal generated by BinaryLit
+const (
+	// CompressionNone keeps the data uncompressed.
+	CompressionNone Compression = iota
+	// CompressionGzip compresses the data in gzip format.
+	CompressionGzip
+	// CompressionFlate compresses the data in raw DEFLATE format.
+	CompressionFlate
+)
+
+// DefaultBinaryWidth is the default number of bytes per line of a literal generated by BinaryLit.
+const DefaultBinaryWidth = 16
+
+// hexDigits are the lower case hexadecimal digits of the bytes of a literal generated by BinaryLit
+const hexDigits = "0123456789abcdef"
+
+// BinaryLitArgs contains the configuration to generate a variable holding binary data with BinaryLit.
+// The data is read from Data and held in variable Ident of type []byte, or string if String is set.
+// Width is the number of bytes per line, DefaultBinaryWidth if zero or negative. If Compression is set,
+// the variable holds the compressed data and function Accessor returns the decompressed data. The identifiers
+// of the packages imported by the accessor are resolved by the import registry Imports, for example of the Package
+// the Code is written to, so that they match its import declaration. If Imports is nil, a new registry is used.
+type BinaryLitArgs struct {
+	Ident       string
+	Data        io.Reader
+	String      bool
+	Width       int
+	Compression Compression
+	Accessor    string
+	Imports     *Imports
+}
+
+// BinaryLit adds a variable declaration holding the data read from a.Data to code, for example data generated by
+// the generator, which does not fit go:embed. The data is emitted as []byte or string literal wrapped in lines of
+// hexadecimal bytes. If compressed, function a.Accessor decompresses the data on its first call and returns it on all
+// calls. The imports of the accessor are registered. A doc comment set with Doc is attached to the variable. If a.Data
+// cannot be read, the compression is invalid, a.Ident or a.Accessor is not a valid identifier or a.Accessor is not set for
+// compressed data, Format returns an error. It returns nil, if code or a is nil.
+func (code *Code) BinaryLit(a *BinaryLitArgs) *Code {
+	// Return nil in case code or a is nil
+	if code == nil || a == nil {
+		return nil
+	}
+	// Read and compress the data
+	b, e := compress(a)
+	if e != nil {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "BinaryLit", Fn: a.Ident, Err: e}))
+		return code
+	}
+	// Add the doc comment and the variable declaration
+	code.attach()
+	code.add("BinaryLit", "var ", a.Ident, " = ", binaryLit(b, a.String, a.Width), "\n")
+	// Add the accessor, if the data is compressed
+	if a.Compression != CompressionNone {
+		code.accessor(a)
+	}
+	// Return code
+	return code
+}
+
+// compress returns the data read from a.Data compressed with a.Compression.
+func compress(a *BinaryLitArgs) ([]byte, error) {
+	// Return an error in case the data is nil
+	if a.Data == nil {
+		return nil, tserr.NilPtr()
+	}
+	// Return an error, if the identifier is invalid
+	if !token.IsIdentifier(a.Ident) {
+		return nil, tserr.Forbidden("identifier " + a.Ident)
+	}
+	// Return an error, if the accessor is not set for compressed data or invalid
+	if a.Compression != CompressionNone && a.Accessor == "" {
+		return nil, tserr.NotSet("Accessor")
+	}
+	if a.Accessor != "" && !token.IsIdentifier(a.Accessor) {
+		return nil, tserr.Forbidden("accessor " + a.Accessor)
+	}
+	// Retrieve the writer for the compression
+	var (
+		b bytes.Buffer
+		w io.WriteCloser
+		e error
+	)
+	switch a.Compression {
+	case CompressionNone:
+		_, e = io.Copy(&b, a.Data)
+		return b.Bytes(), e
+	case CompressionGzip:
+		w, e = gzip.NewWriterLevel(&b, gzip.BestCompression)
+	case CompressionFlate:
+		w, e = flate.NewWriter(&b, flate.BestCompression)
+	default:
+		return nil, tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprint(a.Compression), Want: "Compression"})
+	}
+	if e != nil {
+		return nil, e
+	}
+	// Compress the data
+	if _, e = io.Copy(w, a.Data); e != nil {
+		return nil, e
+	}
+	if e = w.Close(); e != nil {
+		return nil, e
+	}
+	// Return the compressed data
+	return b.Bytes(), nil
+}
+
+// binaryLit returns b as []byte literal, or string literal if str is true, with w bytes per line.
+func binaryLit(b []byte, str bool, w int) string {
+	// Retrieve the number of bytes per line
+	if w <= 0 {
+		w = DefaultBinaryWidth
+	}
+	var s strings.Builder
+	if str {
+		// Return the string literal with one concatenated string per line
+		if len(b) == 0 {
+			return `""`
+		}
+		s.WriteString(`"" +`)
+		for i := 0; i < len(b); i += w {
+			s.WriteString("\n\t\"")
+			for _, c := range b[i:min(i+w, len(b))] {
+				s.WriteString(`\x`)
+				s.WriteByte(hexDigits[c>>4])
+				s.WriteByte(hexDigits[c&0xf])
+			}
+			s.WriteString(`"`)
+			if i+w < len(b) {
+				s.WriteString(" +")
+			}
+		}
+		return s.String()
+	}
+	// Return the []byte literal with w elements per line
+	s.WriteString("[]byte{")
+	for i := 0; i < len(b); i += w {
+		s.WriteString("\n\t")
+		for j, c := range b[i:min(i+w, len(b))] {
+			if j > 0 {
+				s.WriteString(" ")
+			}
+			s.WriteString("0x")
+			s.WriteByte(hexDigits[c>>4])
+			s.WriteByte(hexDigits[c&0xf])
+			s.WriteString(",")
+		}
+	}
+	if len(b) > 0 {
+		s.WriteString("\n")
+	}
+	s.WriteString("}")
+	return s.String()
+}
+
+// accessor adds the function a.Accessor to code, which decompresses the data of variable a.Ident on its first call.
+func (code *Code) accessor(a *BinaryLitArgs) {
+	// Retrieve the import registry
+	imp := a.Imports
+	if imp == nil {
+		imp = NewImports()
+	}
+	// pkg registers import path p and returns its identifier
+	pkg := func(p string) string {
+		code.Import(p)
+		return imp.Add(p)
+	}
+	// Retrieve the type, the reader of the compressed data and the decompressed data
+	t, r, d := "[]byte", "", "b"
+	if a.String {
+		t, r, d = "string", pkg("strings")+".NewReader", "string(b)"
+	} else {
+		r = pkg("bytes") + ".NewReader"
+	}
+	var dec string
+	if a.Compression == CompressionGzip {
+		dec = "r, err := " + pkg("compress/gzip") + ".NewReader(" + r + "(" + a.Ident + "))\nif err != nil {\npanic(err)\n}\n"
+	} else {
+		dec = "r := " + pkg("compress/flate") + ".NewReader(" + r + "(" + a.Ident + "))\n"
+	}
+	rd, sy := pkg("io"), pkg("sync")
+	// Add the variables holding the decompressed data and the accessor
+	o, v := a.Ident+"Once", a.Ident+"Data"
+	code.add("BinaryLit", "\n// ", o, " guards the decompression of ", a.Ident, "\n",
+		"var (\n", o, " ", sy, ".Once\n", v, " ", t, "\n)\n\n",
+		"// ", a.Accessor, " returns the data decompressed from ", a.Ident, ". The data is decompressed on the first call.\n",
+		"func ", a.Accessor, "() ", t, " {\n",
+		o, ".Do(func() {\n",
+		dec,
+		"b, err := ", rd, ".ReadAll(r)\n",
+		"if err != nil {\npanic(err)\n}\n",
+		v, " = ", d, "\n",
+		"})\n",
+		"return ", v, "\n",
+		"}\n")
+}
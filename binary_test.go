@@ -0,0 +1,144 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"bytes"          // bytes
+	"compress/flate" // flate
+	"compress/gzip"  // gzip
+	"encoding/hex"   // hex
+	"errors"         // errors
+	"io"             // io
+	"regexp"         // regexp
+	"strings"        // strings
+	"testing"        // testing
+	"testing/iotest" // iotest
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// hexByte matches a hexadecimal byte of a literal generated by BinaryLit
+var hexByte = regexp.MustCompile(`(?:0x|\\x)([0-9a-f]{2})`)
+
+// TestBinaryLit tests BinaryLit to generate []byte and string literals wrapped in lines of hexadecimal bytes.
+// The test fails if the literals differ from the expected literals.
+func TestBinaryLit(t *testing.T) {
+	// Declare the testcases
+	tcs := []struct {
+		a    *lpcode.BinaryLitArgs
+		want string
+	}{
+		{&lpcode.BinaryLitArgs{Ident: "b", Data: strings.NewReader("lothlorien"), Width: 4},
+			"var b = []byte{\n\t0x6c, 0x6f, 0x74, 0x68,\n\t0x6c, 0x6f, 0x72, 0x69,\n\t0x65, 0x6e,\n}\n"},
+		{&lpcode.BinaryLitArgs{Ident: "s", Data: strings.NewReader("lothlorien"), Width: 8, String: true},
+			"var s = \"\" +\n\t\"\\x6c\\x6f\\x74\\x68\\x6c\\x6f\\x72\\x69\" +\n\t\"\\x65\\x6e\"\n"},
+		{&lpcode.BinaryLitArgs{Ident: "e", Data: strings.NewReader("")}, "var e = []byte{}\n"},
+		{&lpcode.BinaryLitArgs{Ident: "e", Data: strings.NewReader(""), String: true}, "var e = \"\"\n"},
+	}
+	for _, tc := range tcs {
+		// The test fails if the literal differs from the expected literal
+		c := lpcode.NewCode().BinaryLit(tc.a)
+		if e := c.Format(); e != nil {
+			t.Error(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: tc.a.Ident, Err: e}))
+		}
+		if a := c.String(); a != tc.want {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: tc.a.Ident, Actual: a, Want: tc.want}))
+		}
+	}
+}
+
+// TestBinaryLitCompression tests BinaryLit to generate compressed literals with an accessor. The test fails if the
+// generated source code does not type check or if the literal does not decompress to the data.
+func TestBinaryLitCompression(t *testing.T) {
+	// Retrieve the data
+	data := strings.Repeat(testKey, 100)
+	for _, cp := range []lpcode.Compression{lpcode.CompressionGzip, lpcode.CompressionFlate} {
+		for _, str := range []bool{false, true} {
+			// Generate the compressed literal with the accessor
+			c := lpcode.NewCode().Ident("package " + testKey + "\n\n").BinaryLit(&lpcode.BinaryLitArgs{Ident: "data",
+				Data: strings.NewReader(data), String: str, Compression: cp, Accessor: "Data"})
+			// The test fails if the source code does not type check
+			if e := errors.Join(c.Format(), c.Verify(nil)); e != nil {
+				t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Verify", Fn: c.String(), Err: e}))
+			}
+			// Retrieve the compressed literal
+			src := c.String()
+			lit := src[strings.Index(src, "var data"):strings.Index(src, "// dataOnce")]
+			var b []byte
+			for _, m := range hexByte.FindAllStringSubmatch(lit, -1) {
+				h, _ := hex.DecodeString(m[1])
+				b = append(b, h...)
+			}
+			// Decompress the literal
+			var r io.Reader = flate.NewReader(bytes.NewReader(b))
+			if cp == lpcode.CompressionGzip {
+				var e error
+				if r, e = gzip.NewReader(bytes.NewReader(b)); e != nil {
+					t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewReader", Fn: "gzip", Err: e}))
+				}
+			}
+			// The test fails if the literal does not decompress to the data
+			if a, e := io.ReadAll(r); e != nil || string(a) != data {
+				t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "decompressed data", Actual: string(a), Want: data}))
+			}
+		}
+	}
+}
+
+// TestBinaryLitImports tests BinaryLit to resolve the package identifiers of the accessor with the import registry of
+// a Codefile. The test fails if generating the file fails, if the identifier of package sync is not resolved or if the
+// file does not type check.
+func TestBinaryLitImports(t *testing.T) {
+	// Retrieve a Codefile with identifier sync taken by another package
+	cf := newCodefileNamed(t, "testdata/binary.go")
+	cf.Imports().Add("example.com/sync")
+	// Generate the compressed literal with the accessor using the import registry of the Codefile
+	c := lpcode.NewCode().Ident("package " + testKey + "\n").BinaryLit(&lpcode.BinaryLitArgs{Ident: "data",
+		Data: strings.NewReader(testKey), Compression: lpcode.CompressionGzip, Accessor: "Data", Imports: cf.Imports()})
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the identifier of package sync is not resolved
+	a := readFile(t, cf.Filepath())
+	if !strings.Contains(a, "sync2 \"sync\"") || !strings.Contains(a, "dataOnce sync2.Once") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "accessor", Actual: a, Want: "sync2.Once"}))
+	}
+	// The test fails if the file does not type check
+	if e := lpcode.NewCode().Ident(a).Verify(nil); e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Verify", Fn: string(cf.Filepath()), Err: e}))
+	}
+}
+
+// TestBinaryLitErr tests Format to return an error, if the data cannot be read, the compression is invalid,
+// the accessor is missing or an identifier is invalid. The test fails if Format returns nil.
+func TestBinaryLitErr(t *testing.T) {
+	// Declare the invalid arguments
+	tcs := map[string]*lpcode.BinaryLitArgs{
+		"nil":         {Ident: "x"},
+		"read":        {Ident: "x", Data: iotest.ErrReader(io.ErrUnexpectedEOF)},
+		"compression": {Ident: "x", Data: strings.NewReader(testKey), Compression: lpcode.CompressionFlate + 1, Accessor: "X"},
+		"accessor":    {Ident: "x", Data: strings.NewReader(testKey), Compression: lpcode.CompressionGzip},
+		"ident":       {Ident: "x y", Data: strings.NewReader(testKey)},
+		"keyword":     {Ident: "x", Data: strings.NewReader(testKey), Compression: lpcode.CompressionGzip, Accessor: "func"},
+	}
+	for n, tc := range tcs {
+		// The test fails if Format returns nil
+		if e := lpcode.NewCode().BinaryLit(tc).Format(); e == nil {
+			t.Error(tserr.NilFailed(n))
+		}
+	}
+}
+
+// TestBinaryLitNil tests BinaryLit to return nil in case *Code or the arguments are nil.
+// The test fails if BinaryLit does not return nil.
+func TestBinaryLitNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if BinaryLit does not return nil
+	if c.BinaryLit(&lpcode.BinaryLitArgs{}) != nil || lpcode.NewCode().BinaryLit(nil) != nil {
+		t.Error(tserr.NotNil("BinaryLit"))
+	}
+}
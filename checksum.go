@@ -0,0 +1,108 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"bytes"  // bytes
+	"fmt"    // fmt
+	"regexp" // regexp
+)
+
+// checksumPrefix is the prefix of the checksum comment embedded in the header of a generated file
+const checksumPrefix = "// lpcode:checksum "
+
+// checksumLine matches the checksum comment embedded in the header of a generated file
+var checksumLine = regexp.MustCompile(`(?m)^// lpcode:checksum (sha256:[0-9a-f]{64})$`)
+
+// EditedError is returned wrapped by StartFile and FinishFile of a Codefile, if the existing file
+// does not match the checksum embedded in its header, because it was edited manually after it was generated.
+type EditedError struct {
+	File string // path of the file
+}
+
+// Error returns the error message.
+func (e *EditedError) Error() string {
+	// Return an empty string if e is nil
+	if e == nil {
+		return ""
+	}
+	// Return the error message
+	return fmt.Sprintf("%v was edited manually after it was generated, use SetForce to overwrite it", e.File)
+}
+
+// goFormatter returns true, if f formats Go source code. It returns false for NoFormat and for Formatters
+// containing no other formatters. The default formatter, if f is nil, and all other formatters format Go source code.
+func goFormatter(f Formatter) bool {
+	switch t := f.(type) {
+	case NoFormat, *NoFormat:
+		return false
+	case Formatters:
+		// Return true, if any of the contained formatters formats Go source code
+		for _, fm := range t {
+			if fm != nil && goFormatter(fm) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// withChecksum returns b with the checksum comment embedded in its header. The checksum comment follows the
+// first line, if it marks the file as generated. Otherwise, it is the first line followed by an empty line, so that
+// it does not become a doc comment. The checksum is the content hash of the file with an empty checksum.
+func withChecksum(b []byte) []byte {
+	// Retrieve the offset of the checksum comment and the text following it
+	off, sep := 0, "\n\n"
+	if i := bytes.IndexByte(b, '\n'); i >= 0 && generated.Match(b[:i]) {
+		off, sep = i+1, "\n"
+	}
+	// Insert the empty checksum comment
+	o := make([]byte, 0, len(b)+len(checksumPrefix)+len(hashPrefix)+64+len(sep))
+	o = append(append(append(append(o, b[:off]...), checksumPrefix+hashPrefix...), sep...), b[off:]...)
+	// Insert the checksum of the file with the empty checksum comment
+	c := contentHash(o)
+	return append(append(o[:off:off], checksumPrefix+c+sep...), b[off:]...)
+}
+
+// withoutChecksum returns b without the checksum comment embedded in its header by withChecksum.
+// It returns b, if b does not contain a checksum comment.
+func withoutChecksum(b []byte) []byte {
+	// Retrieve the header, which is the source code before the end of the package clause, if any
+	h := b
+	if i := packageClauseEnd(b); i > 0 {
+		h = b[:i]
+	}
+	// Return b, if the header does not contain a checksum comment
+	m := checksumLine.FindIndex(h)
+	if m == nil {
+		return b
+	}
+	// Remove the checksum comment with its new line and the empty line following it at the beginning of the file
+	end := min(m[1]+1, len(b))
+	if m[0] == 0 && end < len(b) && b[end] == '\n' {
+		end++
+	}
+	return append(bytes.Clone(b[:m[0]]), b[end:]...)
+}
+
+// checksumMatches returns true, if b contains a checksum comment in its header and b matches the checksum.
+// The first return value is false, if b does not contain a checksum comment.
+func checksumMatches(b []byte) (bool, bool) {
+	// Retrieve the header, which is the source code before the end of the package clause, if any
+	h := b
+	if i := packageClauseEnd(b); i > 0 {
+		h = b[:i]
+	}
+	// Return false, if the header does not contain a checksum comment
+	m := checksumLine.FindSubmatchIndex(h)
+	if m == nil {
+		return false, false
+	}
+	// Compare the checksum with the content hash of b with an empty checksum
+	e := make([]byte, 0, len(b))
+	e = append(append(append(e, b[:m[2]]...), hashPrefix...), b[m[3]:]...)
+	return true, contentHash(e) == string(b[m[2]:m[3]])
+}
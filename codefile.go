@@ -4,28 +4,78 @@
 package lpcode
 
 import (
-	"go/format"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+	"time"
 
 	"github.com/thorstenrie/tserr"
 	"github.com/thorstenrie/tsfio"
 )
 
+// Codefile generates a source file. The contents of the file are collected in memory
+// by StartFile and WriteCode. FinishFile formats the contents and
+// atomically replaces the file, so that the file is either left untouched or holds the
+// complete, formatted contents. The calls are enforced by a lifecycle State, Generate runs
+// the whole lifecycle.
 type Codefile struct {
-	fn tsfio.Filename
-	fp tsfio.Filename
+	fn   tsfio.Filename
+	fp   tsfio.Filename
+	code *Code         // pending file contents
+	fm   Formatter     // formatter used by Format, Gofmt if nil
+	va   *VerifyArgs   // configuration of the type check in FinishFile, disabled if nil
+	mode Mode          // how FinishFile writes the file
+	st   Status        // result of the last FinishFile
+	dw   io.Writer     // output of the unified diff in ModeDryRun, os.Stdout if nil
+	hdr  *string       // header template, the header file is used if nil
+	ftr  *string       // footer template, the footer file is used if nil
+	td   *TemplateData // data for the header and footer templates
+	fsys FS            // filesystem the file is written to
+	ffs  FS            // filesystem the .lpcode-failed file is written to, fsys if nil
+	imp  *Imports      // import registry
+	ips  []string      // import paths used by the file
+	frc  bool          // overwrite the file, even if it was edited manually
+	trc  bool          // record the call sites of the builder calls
+	lcs  State         // lifecycle state
+}
+
+// TemplateData contains the data passed to the header and footer templates of a Codefile.
+type TemplateData struct {
+	Package   string   // name of the generated package
+	Generator string   // name of the generator
+	Year      int      // year of the generation, the current year if zero
+	Inputs    []string // names of the input files of the generator
+	File      string   // name of the generated file, the base name of the Codefile if empty
 }
 
 const (
 	headerSuffix = ".header"
 	footerSuffix = ".footer"
+	failedSuffix = ".lpcode-failed" // suffix of the file holding the unformatted contents, if formatting fails
 )
 
+// NewCodefile returns a new Codefile for file fn in directory dn written to disk.
 func NewCodefile(dn tsfio.Directory, fn tsfio.Filename) (*Codefile, error) {
+	return NewCodefileFS(DiskFS{}, dn, fn)
+}
+
+// NewCodefileFS returns a new Codefile for file fn in directory dn written to filesystem fsys,
+// for example a MemFS to inspect generated files in tests.
+func NewCodefileFS(fsys FS, dn tsfio.Directory, fn tsfio.Filename) (*Codefile, error) {
+	if fsys == nil {
+		return nil, tserr.NilPtr()
+	}
 	f, err := tsfio.Path(dn, fn)
 	if err != nil {
 		return nil, tserr.Op(&tserr.OpArgs{Op: "Path", Fn: string(dn) + string(fn), Err: err})
 	}
-	cf := &Codefile{fp: f, fn: fn}
+	cf := &Codefile{fp: f, fn: fn, code: NewCode(), fsys: fsys, imp: NewImports()}
 	return cf, nil
 }
 
@@ -36,55 +86,534 @@ func (cf *Codefile) Filepath() tsfio.Filename {
 	return cf.fp
 }
 
+// SetFormatter sets the Formatter f used by Format and FinishFile. If f is nil, Gofmt is used. With
+// NoFormat, FinishFile does not embed a checksum in the header, so that output other than Go source
+// code is written unchanged.
+func (cf *Codefile) SetFormatter(f Formatter) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.fm = f
+	return nil
+}
+
+// SetTrace sets whether the call sites of the builder calls of the Codefile in the generator are
+// recorded, so that a FormatError returned by FinishFile points to the file and line of the
+// offending builder call. It applies to files started after SetTrace. Code written to the Codefile
+// keeps the call sites recorded as set by SetTrace of the Code.
+func (cf *Codefile) SetTrace(t bool) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.trc = t
+	return nil
+}
+
+// SetVerify enables type checking the file with go/types in FinishFile after formatting. The type
+// check is configured by a. If Dir is empty, the directory of the file is used. If Filename is
+// empty, the filename of the file is used. The Go source files in Dir are read from the filesystem
+// of the Codefile, so that files generated before in a Package are included. If a is nil, the type
+// check is disabled.
+func (cf *Codefile) SetVerify(a *VerifyArgs) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	if a == nil {
+		cf.va = nil
+		return nil
+	}
+	va := *a
+	if va.Dir == "" {
+		va.Dir = filepath.Dir(string(cf.fp))
+	}
+	if va.Filename == "" {
+		va.Filename = filepath.Base(string(cf.fp))
+	}
+	cf.va = &va
+	return nil
+}
+
+// SetMode sets the Mode m which defines how FinishFile writes the file. It returns an error, if m
+// is unknown.
+func (cf *Codefile) SetMode(m Mode) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	if m < ModeWrite || m >= modeCount {
+		return tserr.Forbidden(fmt.Sprintf("mode %d", m))
+	}
+	cf.mode = m
+	return nil
+}
+
+// SetHeader sets the header template s. It replaces the header file.
+func (cf *Codefile) SetHeader(s string) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.hdr = &s
+	return nil
+}
+
+// SetFooter sets the footer template s. It replaces the footer file.
+func (cf *Codefile) SetFooter(s string) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.ftr = &s
+	return nil
+}
+
+// SetHeaderFS sets the header template to the contents of file name in fsys, for example an embed.FS.
+// It replaces the header file. It returns an error, if the file cannot be read.
+func (cf *Codefile) SetHeaderFS(fsys fs.FS, name string) error {
+	if cf == nil || fsys == nil {
+		return tserr.NilPtr()
+	}
+	b, e := fs.ReadFile(fsys, name)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: name, Err: e})
+	}
+	return cf.SetHeader(string(b))
+}
+
+// SetFooterFS sets the footer template to the contents of file name in fsys, for example an embed.FS.
+// It replaces the footer file. It returns an error, if the file cannot be read.
+func (cf *Codefile) SetFooterFS(fsys fs.FS, name string) error {
+	if cf == nil || fsys == nil {
+		return tserr.NilPtr()
+	}
+	b, e := fs.ReadFile(fsys, name)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: name, Err: e})
+	}
+	return cf.SetFooter(string(b))
+}
+
+// SetData sets the data d passed to the header and footer templates. The header and footer are only
+// rendered as templates, if data is set. Otherwise, they are used unchanged.
+func (cf *Codefile) SetData(d *TemplateData) error {
+	if cf == nil || d == nil {
+		return tserr.NilPtr()
+	}
+	td := *d
+	cf.td = &td
+	return nil
+}
+
+// template returns the rendered template t. If t is nil, the template is read from file fn in the
+// filesystem of the Codefile. If the file does not exist, an empty string is returned. The template
+// is only rendered, if data is set by SetData. Otherwise, it is returned unchanged, so that for
+// example a header with {{ is kept as is.
+func (cf *Codefile) template(t *string, fn tsfio.Filename) (string, error) {
+	if t == nil {
+		b, e := cf.fsys.ReadFile(fn)
+		if errors.Is(e, fs.ErrNotExist) {
+			return "", nil
+		}
+		if e != nil {
+			return "", tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fn), Err: e})
+		}
+		s := string(b)
+		t = &s
+	}
+	if cf.td == nil {
+		return *t, nil
+	}
+	tp, e := template.New(string(fn)).Option("missingkey=error").Parse(*t)
+	if e != nil {
+		return "", tserr.Op(&tserr.OpArgs{Op: "parse template", Fn: string(fn), Err: e})
+	}
+	d := *cf.td
+	if d.Year == 0 {
+		d.Year = time.Now().Year()
+	}
+	if d.File == "" {
+		d.File = filepath.Base(string(cf.fp))
+	}
+	var b bytes.Buffer
+	if e := tp.Execute(&b, &d); e != nil {
+		return "", tserr.Op(&tserr.OpArgs{Op: "execute template", Fn: string(fn), Err: e})
+	}
+	return b.String(), nil
+}
+
+// SetDiffOutput sets the writer w for the unified diff written by FinishFile in ModeDryRun.
+// If w is nil, the unified diff is written to os.Stdout.
+func (cf *Codefile) SetDiffOutput(w io.Writer) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.dw = w
+	return nil
+}
+
+// Status returns the result of the last FinishFile. It returns StatusNone, if FinishFile did not
+// succeed since StartFile.
+func (cf *Codefile) Status() Status {
+	if cf == nil {
+		return StatusNone
+	}
+	return cf.st
+}
+
+// Verify type checks the pending contents of the file with go/types as configured by SetVerify.
+// It returns Diagnostics, if the type checker reports errors.
+func (cf *Codefile) Verify() error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	if e := cf.require("Verify", StateStarted, StateFinished); e != nil {
+		return e
+	}
+	return cf.verify()
+}
+
+// verify type checks the pending contents as described by Verify.
+func (cf *Codefile) verify() error {
+	va := cf.va
+	if va == nil {
+		va = &VerifyArgs{Dir: filepath.Dir(string(cf.fp)), Filename: filepath.Base(string(cf.fp))}
+	}
+	return verify(cf.fsys, cf.code.canonical().b.Bytes(), va)
+}
+
+// SetForce sets whether FinishFile overwrites the file, even if it does not match the checksum
+// embedded in its header, because it was edited manually.
+func (cf *Codefile) SetForce(f bool) error {
+	if cf == nil {
+		return tserr.NilPtr()
+	}
+	cf.frc = f
+	return nil
+}
+
+// StartFile discards pending contents and starts the file with the rendered header template. The
+// header template is set by SetHeader or SetHeaderFS. Otherwise, the header file with suffix
+// .header read from the filesystem of the Codefile is used, if it exists. If data is set by
+// SetData, the header template is rendered by text/template with the data. Otherwise, the header is
+// used unchanged. The file itself is not changed until FinishFile. In ModeWrite and
+// ModeWriteIfChanged, StartFile returns an error wrapping an EditedError, if the existing file was
+// edited manually after it was generated, unless SetForce is set. StartFile returns an error
+// wrapping a StateError, if the file is already started. If StartFile fails, the Codefile is in
+// StateFailed.
 func (cf *Codefile) StartFile() error {
 	if cf == nil {
 		return tserr.NilPtr()
 	}
-	if e := tsfio.ResetFile(cf.fp); e != nil {
-		return tserr.Op(&tserr.OpArgs{Op: "ResetFile", Fn: string(cf.fp), Err: e})
+	if e := cf.require("StartFile", StateNew, StateFinished, StateFailed); e != nil {
+		return e
+	}
+	cf.code, cf.st, cf.ips, cf.lcs = NewCode().SetTrace(cf.trc), StatusNone, nil, StateFailed
+	if cf.mode == ModeWrite || cf.mode == ModeWriteIfChanged {
+		old, e := cf.fsys.ReadFile(cf.fp)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(cf.fp), Err: e})
+		}
+		if e := cf.edited(old); e != nil {
+			return e
+		}
 	}
-	fh := cf.fn + headerSuffix
-	if e := tsfio.AppendFile(&tsfio.Append{FileA: cf.fp, FileI: fh}); e != nil {
-		return tserr.Op(&tserr.OpArgs{Op: "AppendFile", Fn: string(cf.fp), Err: e})
+	h, e := cf.template(cf.hdr, cf.fn+headerSuffix)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "header", Fn: string(cf.fp), Err: e})
 	}
+	cf.code.add("StartFile", h)
+	cf.lcs = StateStarted
 	return nil
 }
 
-func (cf *Codefile) WriteCode(c string) error {
+// State returns the lifecycle state of the Codefile.
+func (cf *Codefile) State() State {
+	if cf == nil {
+		return StateNew
+	}
+	return cf.lcs
+}
+
+// Generate runs the whole lifecycle of the file: it starts the file, calls f with a new Code to
+// collect the source code, appends the source code to the file and finishes the file. The Code
+// records the call sites of the builder calls, if tracing is enabled by SetTrace. If f returns an
+// error, the file is left untouched, the Codefile is in StateFailed and the error is returned
+// wrapped.
+func (cf *Codefile) Generate(f func(*Code) error) error {
+	if cf == nil || f == nil {
+		return tserr.NilPtr()
+	}
+	if e := cf.StartFile(); e != nil {
+		return e
+	}
+	c := NewCode().SetTrace(cf.trc)
+	if e := f(c); e != nil {
+		cf.lcs = StateFailed
+		return tserr.Op(&tserr.OpArgs{Op: "generate", Fn: string(cf.fp), Err: e})
+	}
+	if e := cf.WriteCode(c); e != nil {
+		cf.lcs = StateFailed
+		return e
+	}
+	return cf.FinishFile()
+}
+
+// Import registers import path p for the file and returns the identifier of the imported package.
+// FinishFile adds an import declaration with all registered import paths after the package clause.
+// If the Codefile belongs to a Package, the identifier is shared by all files of the Package.
+// Import returns an error wrapping a StateError, if the file is not started.
+func (cf *Codefile) Import(p string) (string, error) {
+	if cf == nil {
+		return "", tserr.NilPtr()
+	}
+	if e := cf.require("Import", StateStarted); e != nil {
+		return "", e
+	}
+	if !slices.Contains(cf.ips, p) {
+		cf.ips = append(cf.ips, p)
+	}
+	return cf.imp.Add(p), nil
+}
+
+// Imports returns the import registry of the Codefile, which is shared by all files of a Package.
+// It returns nil, if cf is nil.
+func (cf *Codefile) Imports() *Imports {
 	if cf == nil {
+		return nil
+	}
+	return cf.imp
+}
+
+// WriteCode appends the source code c to the file. It accepts a string, a []byte, a *Code or an
+// io.WriterTo, for example a strings.Reader. If c is a *Code, the builder calls recorded in c are
+// kept, so that errors returned by Format point to the builder call which produced the offending
+// lines. Otherwise, the call site of WriteCode is recorded. It returns an error, if c is of another
+// type or cannot be written.
+func (cf *Codefile) WriteCode(c any) error {
+	if cf == nil || c == nil {
 		return tserr.NilPtr()
 	}
-	return tsfio.WriteStr(cf.fp, c)
+	if e := cf.require("WriteCode", StateStarted); e != nil {
+		return e
+	}
+	switch v := c.(type) {
+	case string:
+		cf.code.add("WriteCode", v)
+	case []byte:
+		cf.code.add("WriteCode", string(v))
+	case *Code:
+		if v == nil {
+			return tserr.NilPtr()
+		}
+		cf.code.addCode(v)
+	case io.WriterTo:
+		var b bytes.Buffer
+		if _, e := v.WriteTo(&b); e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "WriteCode", Fn: string(cf.fp), Err: e})
+		}
+		cf.code.add("WriteCode", b.String())
+	default:
+		return tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprintf("%T", c),
+			Want: "string, []byte, *Code or io.WriterTo"})
+	}
+	return nil
 }
 
+// FinishFile emits the parts of the contents in canonical Go order, fills the placeholders, appends
+// the rendered footer template and adds the import declaration with the imports registered by
+// Import of the Codefile and of the written Code after the package clause. Then, it formats the
+// contents and, if enabled by SetVerify, type checks them. The patterns of variables generated by
+// EmbedVar must match files in the directory of the Codefile in its filesystem. If the contents are
+// type checked or formatted by a Go Formatter, a checksum of the contents is embedded in the
+// header, so that a later run detects manual edits of the file.
+//
+// The Mode set by SetMode defines whether the file is written, the result is reported by Status.
+// The file is replaced atomically in the filesystem of the Codefile, on disk a temporary file in
+// the same directory is renamed. On failure, the file is left untouched. If formatting fails, the
+// returned error wraps a FormatError. FinishFile returns an error wrapping a StateError, if the
+// file is not started. On success, the Codefile is in StateFinished, otherwise in StateFailed.
 func (cf *Codefile) FinishFile() error {
 	if cf == nil {
 		return tserr.NilPtr()
 	}
-	fe := cf.fn + footerSuffix
-	if e := tsfio.AppendFile(&tsfio.Append{FileA: cf.fp, FileI: fe}); e != nil {
-		return tserr.Op(&tserr.OpArgs{Op: "AppendFile", Fn: string(cf.fp), Err: e})
+	if e := cf.require("FinishFile", StateStarted); e != nil {
+		return e
+	}
+	cf.lcs = StateFailed
+	if e := cf.finish(); e != nil {
+		return e
+	}
+	cf.lcs = StateFinished
+	return nil
+}
+
+// finish finishes the started file as described by FinishFile.
+func (cf *Codefile) finish() error {
+	f, e := cf.template(cf.ftr, cf.fn+footerSuffix)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "footer", Fn: string(cf.fp), Err: e})
+	}
+	for _, p := range cf.code.imps {
+		if !slices.Contains(cf.ips, p) {
+			cf.ips = append(cf.ips, p)
+		}
+	}
+	cf.code.imps = nil
+	cf.code = cf.code.canonical()
+	if e := errors.Join(cf.code.invalid(), cf.code.unfilled()); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "fill", Fn: string(cf.fp), Err: e})
+	}
+	if e := cf.code.embedded(cf.fsys, tsfio.Directory(filepath.Dir(string(cf.fp)))); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "embed", Fn: string(cf.fp), Err: e})
 	}
-	if e := cf.Format(); e != nil {
+	cf.code.add("FinishFile", f)
+	if d := cf.imp.decl(cf.ips); d != "" {
+		cf.code.insert(packageClauseEnd(cf.code.b.Bytes()), "Import", d)
+	}
+	failed, ffs := cf.fp+failedSuffix, cf.ffs
+	if ffs == nil {
+		ffs = cf.fsys
+	}
+	write := cf.mode == ModeWrite || cf.mode == ModeWriteIfChanged
+	if e := cf.format(); e != nil {
+		var fe *FormatError
+		if write && errors.As(e, &fe) && ffs.WriteFile(failed, cf.code.b.Bytes()) == nil {
+			fe.Failed = string(failed)
+		}
 		return tserr.Op(&tserr.OpArgs{Op: "format", Fn: string(cf.fp), Err: e})
 	}
+	if cf.va != nil {
+		if e := cf.verify(); e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "verify", Fn: string(cf.fp), Err: e})
+		}
+	}
+	if cf.checksum() {
+		c := withChecksum(cf.code.b.Bytes())
+		cf.code.b.Reset()
+		cf.code.b.Write(c)
+	}
+	old, e := cf.fsys.ReadFile(cf.fp)
+	if e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(cf.fp), Err: e})
+	}
+	exists := e == nil
+	if cf.mode == ModeDryRun {
+		w := cf.dw
+		if w == nil {
+			w = os.Stdout
+		}
+		a := &DiffArgs{OldName: string(cf.fp), NewName: string(cf.fp) + " (generated)", Old: old, New: cf.code.b.Bytes()}
+		if e := WriteDiff(w, a); e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "WriteDiff", Fn: string(cf.fp), Err: e})
+		}
+		switch {
+		case !exists:
+			cf.st = StatusCreated
+		case bytes.Equal(old, cf.code.b.Bytes()):
+			cf.st = StatusUnchanged
+		default:
+			cf.st = StatusUpdated
+		}
+		return nil
+	}
+	if cf.mode == ModeCheck {
+		if d := unifiedDiff(string(cf.fp), string(cf.fp)+" (generated)", old, cf.code.b.Bytes()); d != "" || !exists {
+			return tserr.Op(&tserr.OpArgs{Op: "check", Fn: string(cf.fp), Err: &CheckError{File: string(cf.fp), Diff: d}})
+		}
+		cf.st = StatusUnchanged
+		return nil
+	}
+	if e := cf.edited(old); e != nil {
+		return e
+	}
+	if e := ffs.RemoveFile(failed); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "RemoveFile", Fn: string(failed), Err: e})
+	}
+	if exists && cf.mode == ModeWriteIfChanged && bytes.Equal(old, cf.code.b.Bytes()) {
+		cf.st = StatusUnchanged
+		return nil
+	}
+	if e := cf.fsys.WriteFile(cf.fp, cf.code.b.Bytes()); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: string(cf.fp), Err: e})
+	}
+	cf.st = StatusCreated
+	if exists {
+		cf.st = StatusUpdated
+	}
 	return nil
 }
 
+// Format reformats the finished file in the filesystem of the Codefile with the Formatter set by
+// SetFormatter, by default in canonical gofmt style, and rewrites it, for example after the
+// Formatter was changed. The checksum embedded in its header is updated. FinishFile formats the
+// contents, so that Format is only allowed in StateFinished. Otherwise, it returns an error
+// wrapping a StateError, because formatting incomplete contents would corrupt the file. In
+// ModeCheck and ModeDryRun, the file is never written, so that Format does nothing. Format returns
+// an error wrapping an EditedError, if the file does not match its checksum, unless SetForce is
+// set. In case of a syntax error, the returned error wraps a FormatError with the offending lines.
 func (cf *Codefile) Format() error {
 	if cf == nil {
 		return tserr.NilPtr()
 	}
-	i, e := tsfio.ReadFile(cf.fp)
+	if e := cf.require("Format", StateFinished); e != nil {
+		return e
+	}
+	if cf.mode != ModeWrite && cf.mode != ModeWriteIfChanged {
+		return nil
+	}
+	old, e := cf.fsys.ReadFile(cf.fp)
 	if e != nil {
 		return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(cf.fp), Err: e})
 	}
-	o, e := format.Source(i)
+	if e := cf.edited(old); e != nil {
+		return e
+	}
+	o, e := formatSource(cf.fm, withoutChecksum(old), nil)
+	if e != nil {
+		if fe, ok := e.(*FormatError); ok {
+			fe.File = string(cf.fp)
+		}
+		return tserr.Op(&tserr.OpArgs{Op: "Format", Fn: string(cf.fp), Err: e})
+	}
+	if cf.checksum() {
+		o = withChecksum(o)
+	}
+	if bytes.Equal(o, old) {
+		return nil
+	}
+	if e := cf.fsys.WriteFile(cf.fp, o); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: string(cf.fp), Err: e})
+	}
+	return nil
+}
+
+// format formats the pending contents with the Formatter set by SetFormatter.
+func (cf *Codefile) format() error {
+	o, e := formatSource(cf.fm, cf.code.b.Bytes(), cf.code.spans)
 	if e != nil {
-		return tserr.Op(&tserr.OpArgs{Op: "Source", Fn: string(cf.fp), Err: e})
+		if fe, ok := e.(*FormatError); ok {
+			fe.File = string(cf.fp)
+		}
+		return tserr.Op(&tserr.OpArgs{Op: "Format", Fn: string(cf.fp), Err: e})
+	}
+	cf.code.b.Reset()
+	cf.code.b.Write(o)
+	cf.code.spans = nil
+	return nil
+}
+
+// checksum returns true, if the checksum is embedded in the header of the file. It is only embedded
+// in Go source code, which is the case if the contents are type checked or formatted by a Formatter
+// other than NoFormat.
+func (cf *Codefile) checksum() bool {
+	return cf.va != nil || goFormatter(cf.fm)
+}
+
+// edited returns an error wrapping an EditedError, if old contains a checksum in its header and
+// does not match it, unless SetForce is set or no checksum is embedded in the file.
+func (cf *Codefile) edited(old []byte) error {
+	if cf.frc || !cf.checksum() {
+		return nil
 	}
-	if e := tsfio.WriteSingleStr(cf.fp, string(o)); e != nil {
-		return tserr.Op(&tserr.OpArgs{Op: "WriteSingleStr", Fn: string(cf.fp), Err: e})
+	if found, ok := checksumMatches(old); found && !ok {
+		return tserr.Op(&tserr.OpArgs{Op: "overwrite", Fn: string(cf.fp), Err: &EditedError{File: string(cf.fp)}})
 	}
 	return nil
 }
@@ -0,0 +1,545 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"bytes"          // bytes
+	"errors"         // errors
+	"fmt"            // fmt
+	"io/fs"          // fs
+	"os"             // os
+	"path/filepath"  // filepath
+	"strings"        // strings
+	"testing"        // testing
+	"testing/fstest" // fstest
+	"time"           // time
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// testCodefile is the name of the test Codefile. The header and footer files are
+// located in testdata.
+const testCodefile = "testdata/codefile.go"
+
+// newCodefile returns a new Codefile for testCodefile in a temporary directory. The test fails,
+// if the Codefile cannot be created.
+func newCodefile(t *testing.T) *lpcode.Codefile {
+	// Return the Codefile for testCodefile
+	return newCodefileNamed(t, testCodefile)
+}
+
+// newCodefileNamed returns a new Codefile for fn in testdata of a temporary directory. The test fails,
+// if the Codefile cannot be created.
+func newCodefileNamed(t *testing.T, fn tsfio.Filename) *lpcode.Codefile {
+	// Create the temporary directory
+	d := t.TempDir()
+	if e := os.Mkdir(filepath.Join(d, "testdata"), 0755); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Mkdir", Fn: d, Err: e}))
+	}
+	// Retrieve the Codefile
+	cf, e := lpcode.NewCodefile(tsfio.Directory(d), fn)
+	// The test fails if NewCodefile returns an error
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewCodefile", Fn: d, Err: e}))
+	}
+	// Return the Codefile
+	return cf
+}
+
+// generate runs StartFile, WriteCode with c and FinishFile on cf. It returns the error of
+// the first failing method, if any.
+func generate(cf *lpcode.Codefile, c *lpcode.Code) error {
+	// Start the file
+	if e := cf.StartFile(); e != nil {
+		return e
+	}
+	// Write the source code
+	if e := cf.WriteCode(c); e != nil {
+		return e
+	}
+	// Finish the file
+	return cf.FinishFile()
+}
+
+// readFile returns the contents of fn. The test fails if the file cannot be read.
+func readFile(t *testing.T, fn tsfio.Filename) string {
+	// Read the file
+	b, e := tsfio.ReadFile(fn)
+	// The test fails if ReadFile returns an error
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fn), Err: e}))
+	}
+	// Return the contents
+	return string(b)
+}
+
+// TestCodefile tests generating a Codefile with header, source code and footer. The test
+// fails if the generated file does not match the contents of the golden file.
+func TestCodefile(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// Generate the file with a type declaration
+	c := lpcode.NewCode().TypeStruct(testStruct).VarSpec(&lpcode.VarSpecArgs{Ident: testIdent, Type: testType}).BlockEnd()
+	if e := generate(cf, c); e != nil {
+		// The test fails if generate returns an error
+		t.Fatal(e)
+	}
+	// The test fails if the generated file does not match the contents of the golden file
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "codefile", Data: readFile(t, cf.Filepath())}); e != nil {
+		t.Error(e)
+	}
+}
+
+// TestCodefileAtomic tests FinishFile to leave an existing file untouched in case formatting fails. The test fails,
+// if FinishFile does not return an error, if the file is changed or if a temporary file is left in the directory.
+// Only the file holding the unformatted contents is expected besides the existing file.
+func TestCodefileAtomic(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// Create an existing file
+	if e := tsfio.WriteSingleStr(cf.Filepath(), testComment); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteSingleStr", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if generating the file with a syntax error does not fail
+	if e := generate(cf, lpcode.NewCode().Call(testCall)); e == nil {
+		t.Error(tserr.NilFailed("FinishFile"))
+	}
+	// The test fails if the existing file is changed
+	if f := readFile(t, cf.Filepath()); f != testComment {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: f, Want: testComment}))
+	}
+	// The test fails if the directory contains other files than the existing file and the failed file
+	if m, _ := filepath.Glob(filepath.Join(filepath.Dir(string(cf.Filepath())), "*")); len(m) != 2 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "files", Actual: int64(len(m)), Want: 2}))
+	}
+}
+
+// TestCodefileWriteIfChanged tests FinishFile in ModeWriteIfChanged to report created, unchanged and updated files
+// and to keep the file untouched if the contents are unchanged. The test fails if Status does not report the expected
+// result or if the modification time of an unchanged file changes.
+func TestCodefileWriteIfChanged(t *testing.T) {
+	// Retrieve a new Codefile in ModeWriteIfChanged
+	cf := newCodefile(t)
+	if e := cf.SetMode(lpcode.ModeWriteIfChanged); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetMode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// Declare the expected results of generating the file with a type declaration for each struct name
+	cases := []struct {
+		name string
+		want lpcode.Status
+	}{{testStruct, lpcode.StatusCreated}, {testStruct, lpcode.StatusUnchanged}, {testKey, lpcode.StatusUpdated}}
+	// Set the modification time to the past after each run
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, tc := range cases {
+		// Generate the file with a type declaration
+		if e := generate(cf, lpcode.NewCode().TypeStruct(tc.name).BlockEnd()); e != nil {
+			t.Fatal(e)
+		}
+		// The test fails if Status does not report the expected result
+		if s := cf.Status(); s != tc.want {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Status", Actual: s.String(), Want: tc.want.String()}))
+		}
+		// The test fails if the modification time of an unchanged file changes
+		fi, e := os.Stat(string(cf.Filepath()))
+		if e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: string(cf.Filepath()), Err: e}))
+		}
+		if tc.want == lpcode.StatusUnchanged && !fi.ModTime().Equal(past) {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "ModTime", Actual: fi.ModTime().String(), Want: past.String()}))
+		}
+		if e := os.Chtimes(string(cf.Filepath()), past, past); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Chtimes", Fn: string(cf.Filepath()), Err: e}))
+		}
+	}
+}
+
+// TestCodefileSetModeErr tests SetMode to return an error for an unknown Mode.
+// The test fails if SetMode returns nil.
+func TestCodefileSetModeErr(t *testing.T) {
+	// The test fails if SetMode returns nil
+	if e := newCodefile(t).SetMode(lpcode.Mode(-1)); e == nil {
+		t.Error(tserr.NilFailed("SetMode"))
+	}
+}
+
+// TestCodefileCheck tests FinishFile in ModeCheck to accept an up to date file and to return a CheckError
+// with a unified diff for an outdated file without changing it. The test fails if FinishFile does not return the
+// expected result or if the file is changed.
+func TestCodefileCheck(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// Generate the file with a type declaration
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testStruct).BlockEnd()); e != nil {
+		t.Fatal(e)
+	}
+	f := readFile(t, cf.Filepath())
+	// Set ModeCheck
+	if e := cf.SetMode(lpcode.ModeCheck); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetMode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if FinishFile returns an error for the up to date file
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testStruct).BlockEnd()); e != nil || cf.Status() != lpcode.StatusUnchanged {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "check", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if FinishFile does not return a CheckError for the outdated file
+	var ce *lpcode.CheckError
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testKey).BlockEnd()); !errors.As(e, &ce) {
+		t.Fatal(tserr.NilFailed("FinishFile"))
+	}
+	// The test fails if the unified diff does not contain the changed lines
+	want := " package mirkwood\n \n-type " + testStruct + " struct {\n+type " + testKey + " struct {\n }\n"
+	if !strings.Contains(ce.Diff, want) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Diff", Actual: ce.Diff, Want: want}))
+	}
+	// The test fails if the file is changed
+	if a := readFile(t, cf.Filepath()); a != f {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: f}))
+	}
+}
+
+// TestCodefileDryRun tests FinishFile in ModeDryRun to write a unified diff without changing the file.
+// The test fails if the diff is not written, if Status does not report StatusUpdated or if the file is changed.
+func TestCodefileDryRun(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// Generate the file with a type declaration
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testStruct).BlockEnd()); e != nil {
+		t.Fatal(e)
+	}
+	f := readFile(t, cf.Filepath())
+	// Set ModeDryRun with the diff written to a buffer
+	var b bytes.Buffer
+	if e := errors.Join(cf.SetMode(lpcode.ModeDryRun), cf.SetDiffOutput(&b)); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetMode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// Generate the file with another type declaration
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testKey).BlockEnd()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the diff does not contain the changed line
+	if !strings.Contains(b.String(), "+type "+testKey+" struct {\n") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "diff", Actual: b.String(), Want: "+type " + testKey + " struct {"}))
+	}
+	// The test fails if Status does not report StatusUpdated
+	if s := cf.Status(); s != lpcode.StatusUpdated {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Status", Actual: s.String(), Want: lpcode.StatusUpdated.String()}))
+	}
+	// The test fails if the file is changed
+	if a := readFile(t, cf.Filepath()); a != f {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: f}))
+	}
+}
+
+// TestCodefileDryRunLarge tests FinishFile in ModeDryRun for a large file, which is entirely rewritten. The test fails
+// if FinishFile takes longer than ten seconds or the diff does not delete and insert all declarations.
+func TestCodefileDryRunLarge(t *testing.T) {
+	// vars returns a declaration of 10000 variables with prefix p
+	vars := func(p string) *lpcode.Code {
+		c := lpcode.NewCode()
+		for i := 0; i < 10000; i++ {
+			fmt.Fprintf(c, "var %v%d int\n", p, i)
+		}
+		return c
+	}
+	// Generate the file with the variables
+	cf := newCodefile(t)
+	if e := generate(cf, vars(testKey)); e != nil {
+		t.Fatal(e)
+	}
+	// Set ModeDryRun with the diff written to a buffer
+	var b bytes.Buffer
+	if e := errors.Join(cf.SetMode(lpcode.ModeDryRun), cf.SetDiffOutput(&b)); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetMode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if FinishFile with other variables takes longer than ten seconds
+	s := time.Now()
+	if e := generate(cf, vars(testIdent)); e != nil {
+		t.Fatal(e)
+	}
+	if d := time.Since(s); d > 10*time.Second {
+		t.Error(tserr.Lower(&tserr.LowerArgs{Var: "duration of FinishFile in seconds", Actual: int64(d.Seconds()), Want: 10}))
+	}
+	// The test fails if the diff does not delete and insert all declarations
+	if a := strings.Count(b.String(), "\n-var "+testKey); a != 10000 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "deleted declarations", Actual: int64(a), Want: 10000}))
+	}
+	if a := strings.Count(b.String(), "\n+var "+testIdent); a != 10000 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "inserted declarations", Actual: int64(a), Want: 10000}))
+	}
+}
+
+// TestCodefileTemplate tests generating a Codefile with a header template set by SetHeader and a footer
+// template set by SetFooterFS rendered with the data set by SetData. The test fails if the generated file
+// does not match the contents of the golden file.
+func TestCodefileTemplate(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// Set the header, footer and template data
+	fsys := fstest.MapFS{"footer.tmpl": {Data: []byte("\n// Inputs:{{range .Inputs}} {{.}}{{end}}\n")}}
+	if e := errors.Join(
+		cf.SetHeader("// Code generated by {{.Generator}} from {{.File}}. DO NOT EDIT.\n\n// Copyright (c) {{.Year}}\npackage {{.Package}}\n"),
+		cf.SetFooterFS(fsys, "footer.tmpl"),
+		cf.SetData(&lpcode.TemplateData{Package: testKey, Generator: testCall, Year: 2023, Inputs: []string{testElem, testExpr}}),
+	); e != nil {
+		t.Fatal(e)
+	}
+	// Generate the file with a type declaration
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testStruct).BlockEnd()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the generated file does not match the contents of the golden file
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "codefiletemplate", Data: readFile(t, cf.Filepath())}); e != nil {
+		t.Error(e)
+	}
+}
+
+// TestCodefileNoHeader tests generating a Codefile without header and footer files. The test fails
+// if generating the file returns an error or if the file does not contain the source code.
+func TestCodefileNoHeader(t *testing.T) {
+	// Retrieve a new Codefile without header and footer files
+	cf := newCodefileNamed(t, "testdata/noheader.go")
+	// The test fails if generating the file returns an error
+	if e := generate(cf, lpcode.NewCode().Ident("package "+testKey+"\n")); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the file does not contain the checksum followed by the source code
+	if f := readFile(t, cf.Filepath()); !strings.HasPrefix(f, "// lpcode:checksum ") || !strings.HasSuffix(f, "\n\npackage "+testKey+"\n") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: f, Want: "package " + testKey}))
+	}
+}
+
+// TestCodefileNoFormat tests generating a Codefile with output other than Go source code using NoFormat. The test fails
+// if generating the file returns an error, if the file differs from the output or if regenerating an edited file fails.
+func TestCodefileNoFormat(t *testing.T) {
+	// Retrieve a new Codefile with NoFormat
+	cf := newCodefileNamed(t, "testdata/noformat.json")
+	if e := cf.SetFormatter(lpcode.NoFormat{}); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetFormatter", Fn: string(cf.Filepath()), Err: e}))
+	}
+	want := "{\"" + testKey + "\": 1}\n"
+	for i := 0; i < 2; i++ {
+		// The test fails if generating the file returns an error
+		if e := generate(cf, lpcode.NewCode().Ident(want)); e != nil {
+			t.Fatal(e)
+		}
+		// The test fails if the file differs from the output without checksum
+		if a := readFile(t, cf.Filepath()); a != want {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: want}))
+		}
+		// Edit the file, which must not prevent regenerating it
+		if e := os.WriteFile(string(cf.Filepath()), []byte("{}\n"), 0644); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: string(cf.Filepath()), Err: e}))
+		}
+	}
+}
+
+// TestCodefileFormat tests Format to reformat a finished file with another Formatter and to update its checksum.
+// The test fails if Format returns an error, if the file is not reformatted or if regenerating the file
+// with the Formatter does not leave it unchanged.
+func TestCodefileFormat(t *testing.T) {
+	// Generate a function with an empty line at the beginning of its body formatted by Gofmt
+	cf := newCodefileNamed(t, "testdata/format.go")
+	c := func() *lpcode.Code {
+		return lpcode.NewCode().Ident("package " + testKey + "\n\nfunc " + testIdent + "() {\n\n\tprintln()\n}\n")
+	}
+	if e := generate(cf, c()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if Format with Strict returns an error
+	if e := errors.Join(cf.SetFormatter(lpcode.Strict{}), cf.Format()); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if the empty line is not removed
+	if a := readFile(t, cf.Filepath()); strings.Contains(a, "{\n\n") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: "function without empty line"}))
+	}
+	// The test fails if regenerating the file with Strict does not leave it unchanged
+	if e := cf.SetMode(lpcode.ModeWriteIfChanged); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetMode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := generate(cf, c()); e != nil || cf.Status() != lpcode.StatusUnchanged {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "status", Actual: int64(cf.Status()), Want: int64(lpcode.StatusUnchanged)}))
+	}
+}
+
+// TestCodefileTemplateErr tests StartFile to return an error for a header template
+// referring to missing data. The test fails if StartFile returns nil.
+func TestCodefileTemplateErr(t *testing.T) {
+	// Retrieve a new Codefile with a header template referring to missing data
+	cf := newCodefile(t)
+	if e := errors.Join(cf.SetHeader("package {{.Missing}}\n"), cf.SetData(&lpcode.TemplateData{})); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if StartFile returns nil
+	if e := cf.StartFile(); e == nil {
+		t.Error(tserr.NilFailed("StartFile"))
+	}
+}
+
+// TestCodefileEdited tests StartFile and FinishFile to refuse overwriting a file edited manually after it was generated.
+// The test fails if StartFile or FinishFile do not return an EditedError, if the edited file is changed or if
+// the file is not overwritten with SetForce.
+func TestCodefileEdited(t *testing.T) {
+	// Retrieve a new Codefile and generate the file
+	cf := newCodefile(t)
+	c := lpcode.NewCode().TypeStruct(testStruct).BlockEnd()
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// Edit the file manually
+	g := readFile(t, cf.Filepath())
+	f := g + "// edited\n"
+	if e := tsfio.WriteSingleStr(cf.Filepath(), f); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteSingleStr", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if StartFile does not return an EditedError
+	var ee *lpcode.EditedError
+	if e := cf.StartFile(); !errors.As(e, &ee) {
+		t.Error(tserr.NilFailed("StartFile"))
+	}
+	// The test fails if the file is changed
+	if a := readFile(t, cf.Filepath()); a != f {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: f}))
+	}
+	// The test fails if the file is not overwritten with SetForce
+	if e := cf.SetForce(true); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetForce", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	if a := readFile(t, cf.Filepath()); a != g {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: g}))
+	}
+	// Edit the file manually after StartFile
+	if e := errors.Join(cf.SetForce(false), cf.StartFile(), cf.WriteCode(c), tsfio.WriteSingleStr(cf.Filepath(), f)); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if FinishFile does not return an EditedError
+	if e := cf.FinishFile(); !errors.As(e, &ee) {
+		t.Error(tserr.NilFailed("FinishFile"))
+	}
+}
+
+// TestCodefileFailed tests FinishFile to write the unformatted contents to the .lpcode-failed file and to return a
+// FormatError with file and position, if formatting fails. The test fails if the error does not contain the file and
+// position, if the .lpcode-failed file does not contain the unformatted contents or if it is not removed by the next
+// successful FinishFile.
+func TestCodefileFailed(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	failed := cf.Filepath() + ".lpcode-failed"
+	// The test fails if FinishFile does not return a FormatError with the file and position
+	var fe *lpcode.FormatError
+	if e := generate(cf, lpcode.NewCode().Call(testCall)); !errors.As(e, &fe) {
+		t.Fatal(tserr.NilFailed("FinishFile"))
+	}
+	if fe.File != string(cf.Filepath()) || fe.Failed != string(failed) || fe.Line == 0 ||
+		!strings.HasPrefix(fe.Error(), string(cf.Filepath())+":") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "FormatError", Actual: fe.Error(), Want: string(cf.Filepath()) + ":line:column"}))
+	}
+	// The test fails if the .lpcode-failed file does not contain the unformatted contents
+	if f := readFile(t, failed); !strings.Contains(f, testCall) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(failed), Actual: f, Want: testCall}))
+	}
+	// The test fails if the next successful FinishFile does not remove the .lpcode-failed file
+	if e := generate(cf, lpcode.NewCode().TypeStruct(testStruct).BlockEnd()); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(string(failed)); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: string(failed), Err: e}))
+	}
+}
+
+// TestCodefileState tests the lifecycle state of a Codefile. The test fails if an out-of-order call does not
+// return a StateError or if the Codefile is not in the expected state.
+func TestCodefileState(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	var se *lpcode.StateError
+	// The test fails if writing before StartFile or finishing a new file does not return a StateError
+	if e := cf.WriteCode(testIdent); !errors.As(e, &se) || cf.State() != lpcode.StateNew {
+		t.Error(tserr.NilFailed("WriteCode"))
+	}
+	if e := errors.Join(cf.WriteCode(lpcode.NewCode()), cf.FinishFile()); !errors.As(e, &se) {
+		t.Error(tserr.NilFailed("WriteCode and FinishFile"))
+	}
+	if i, e := cf.Import("fmt"); !errors.As(e, &se) || i != "" {
+		t.Error(tserr.NilFailed("Import"))
+	}
+	// The test fails if starting a started file or formatting incomplete contents does not return a StateError
+	if e := cf.StartFile(); e != nil || cf.State() != lpcode.StateStarted {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "StartFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := errors.Join(cf.StartFile(), cf.Format()); !errors.As(e, &se) || se.State != lpcode.StateStarted {
+		t.Error(tserr.NilFailed("StartFile and Format"))
+	}
+	// The test fails if finishing a finished file does not return a StateError
+	if e := cf.FinishFile(); e != nil || cf.State() != lpcode.StateFinished {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "FinishFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := cf.FinishFile(); !errors.As(e, &se) {
+		t.Error(tserr.NilFailed("FinishFile"))
+	}
+	// The test fails if a failed FinishFile does not result in StateFailed
+	if e := generate(cf, lpcode.NewCode().Call(testCall)); e == nil || cf.State() != lpcode.StateFailed {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "state", Actual: int64(cf.State()), Want: int64(lpcode.StateFailed)}))
+	}
+}
+
+// TestCodefileWriteCode tests WriteCode to append source code given as string, []byte, *Code and io.WriterTo
+// and to return an error for another type. The test fails if the file does not contain the source code in order
+// or if WriteCode of another type returns nil.
+func TestCodefileWriteCode(t *testing.T) {
+	// Retrieve a started Codefile
+	cf := newCodefile(t)
+	if e := cf.StartFile(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "StartFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if WriteCode of another type returns nil
+	if e := cf.WriteCode(42); e == nil {
+		t.Error(tserr.NilFailed("WriteCode"))
+	}
+	// Write the source code with each accepted type
+	if e := errors.Join(cf.WriteCode("var a = 1\n"), cf.WriteCode([]byte("var b = 2\n")),
+		cf.WriteCode(lpcode.NewCode().Ident("var c = 3\n")), cf.WriteCode(strings.NewReader("var d = 4\n")),
+		cf.FinishFile()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the file does not contain the source code in order
+	if a, w := readFile(t, cf.Filepath()), "var a = 1\nvar b = 2\nvar c = 3\nvar d = 4\n"; !strings.Contains(a, w) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: w}))
+	}
+}
+
+// TestCodefileGenerate tests Generate to run the whole lifecycle of a Codefile. The test fails if the generated file
+// does not match the golden file or if an error of the generator function does not leave the file untouched in StateFailed.
+func TestCodefileGenerate(t *testing.T) {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	// The test fails if the generated file does not match the golden file
+	if e := cf.Generate(func(c *lpcode.Code) error {
+		c.TypeStruct(testStruct).VarSpec(&lpcode.VarSpecArgs{Ident: testIdent, Type: testType}).BlockEnd()
+		return nil
+	}); e != nil || cf.State() != lpcode.StateFinished {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Generate", Fn: string(cf.Filepath()), Err: e}))
+	}
+	f := readFile(t, cf.Filepath())
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "codefile", Data: f}); e != nil {
+		t.Error(e)
+	}
+	// The test fails if an error of the generator function is not returned or changes the file
+	if e := cf.Generate(func(c *lpcode.Code) error {
+		c.TypeStruct(testKey)
+		return errors.New(testComment)
+	}); e == nil || cf.State() != lpcode.StateFailed {
+		t.Error(tserr.NilFailed("Generate"))
+	}
+	if a := readFile(t, cf.Filepath()); a != f {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: a, Want: f}))
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"bytes"  // bytes
+	"slices" // slices
+)
+
+// Part is a named part of Code. Declarations discovered while generating the source code, for example a
+// constant or helper type needed by a function body, can be appended to a part with Declare at any time. The parts
+// are emitted in canonical Go order: after the package clause and import declarations, the imports registered with Import
+// are followed by the constants, variables and types. Then follows the source code written by the builder calls, followed
+// by the functions and tests.
+type Part int
+
+// Parts of Code in canonical Go order
+const (
+	// PartConsts contains constant declarations.
+	PartConsts Part = iota
+	// PartVars contains variable declarations.
+	PartVars
+	// PartTypes contains type declarations.
+	PartTypes
+	// PartFuncs contains function and method declarations.
+	PartFuncs
+	// PartTests contains test functions.
+	PartTests
+	// partCount is the number of parts
+	partCount
+)
+
+// Import registers import path p in the imports part of code. Each import path is emitted once. If code is written to a
+// Codefile, the import path is registered by Import of the Codefile. It returns nil, if code is nil.
+func (code *Code) Import(p string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Register p, if it is not registered yet
+	if !slices.Contains(code.imps, p) {
+		code.imps = append(code.imps, p)
+	}
+	// Return code
+	return code
+}
+
+// Declare appends the declaration c to part s of code. A declaration identical to a declaration already in
+// part s, ignoring leading and trailing white space, is skipped. Imports and declarations in the parts of c
+// are added to the parts of code. The builder calls recorded in c are kept. Declare returns code unchanged, if s
+// is not a valid part or c is nil. It returns nil, if code is nil.
+func (code *Code) Declare(s Part, c *Code) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Return code, if s is invalid or c is nil
+	if s < PartConsts || s >= partCount || c == nil {
+		return code
+	}
+	// Add the imports and declarations of c
+	code.merge(c)
+	// Append the declaration, if it is not a duplicate
+	d := bytes.TrimSpace(c.b.Bytes())
+	if !slices.ContainsFunc(code.decls[s], func(e *Code) bool { return bytes.Equal(bytes.TrimSpace(e.b.Bytes()), d) }) {
+		n := &Code{spans: slices.Clone(c.spans), phs: slices.Clone(c.phs)}
+		n.b.Write(c.b.Bytes())
+		code.decls[s] = append(code.decls[s], n)
+	}
+	// Return code
+	return code
+}
+
+// merge adds the imports and declarations in the parts of c to the parts of code as well as
+// the build constraints, errors of invalid directives and embed patterns of c.
+func (code *Code) merge(c *Code) {
+	// Add the build constraints and errors
+	for _, b := range c.cons {
+		if !slices.Contains(code.cons, b) {
+			code.cons = append(code.cons, b)
+		}
+	}
+	code.errs = append(code.errs, c.errs...)
+	code.embs = append(code.embs, c.embs...)
+	// Add the imports
+	for _, p := range c.imps {
+		code.Import(p)
+	}
+	// Add the declarations
+	for s := range c.decls {
+		for _, d := range c.decls[s] {
+			code.Declare(Part(s), d)
+		}
+	}
+}
+
+// hasParts returns true, if code contains imports or declarations in its parts, placeholders or build constraints.
+func (code *Code) hasParts() bool {
+	// Return true, if an import, a placeholder or a build constraint is registered
+	if len(code.imps) > 0 || len(code.phs) > 0 || len(code.cons) > 0 {
+		return true
+	}
+	// Return true, if a part contains a declaration
+	for s := range code.decls {
+		if len(code.decls[s]) > 0 {
+			return true
+		}
+	}
+	// Return false
+	return false
+}
+
+// canonical returns the source code of code with the build constraints, the parts emitted in canonical Go order and the
+// placeholders filled. It returns code, if its parts, placeholders and build constraints are empty. Otherwise, code is not
+// changed and a new Code without parts is returned, which only contains the unfilled placeholders, the errors of invalid directives and the embed patterns.
+func (code *Code) canonical() *Code {
+	// Return code, if its parts are empty
+	if !code.hasParts() {
+		return code
+	}
+	// Copy the source code and the builder calls
+	n := &Code{fm: code.fm, trc: code.trc, spans: slices.Clone(code.spans), phs: slices.Clone(code.phs), errs: code.errs, embs: code.embs}
+	n.b.Write(code.b.Bytes())
+	// Insert the build constraints before the package clause
+	if b := code.buildLine(); b != "" {
+		h := &Code{}
+		h.add("BuildConstraint", b)
+		n.insertCode(max(packageClauseStart(n.b.Bytes()), 0), h)
+	}
+	// Insert the imports, constants, variables and types after the package clause and import declarations
+	off := declStart(n.b.Bytes())
+	h := &Code{}
+	if off > 0 {
+		h.b.WriteString("\n")
+	}
+	if d := NewImports().decl(code.imps); d != "" {
+		h.add("Import", d)
+	}
+	for _, s := range []Part{PartConsts, PartVars, PartTypes} {
+		for _, d := range code.decls[s] {
+			h.addDecl(d)
+		}
+	}
+	n.insertCode(off, h)
+	// Append the functions and tests
+	for _, s := range []Part{PartFuncs, PartTests} {
+		for _, d := range code.decls[s] {
+			if !bytes.HasSuffix(n.b.Bytes(), []byte("\n\n")) {
+				n.b.WriteString("\n")
+			}
+			n.addDecl(d)
+		}
+	}
+	// Fill the placeholders
+	n.fillPlaceholders()
+	// Return the new Code
+	return n
+}
+
+// addDecl appends declaration d followed by an empty line to code.
+func (code *Code) addDecl(d *Code) {
+	// Append the declaration
+	code.addCode(d)
+	// Terminate the declaration with a new line and an empty line
+	if !bytes.HasSuffix(d.b.Bytes(), []byte("\n")) {
+		code.b.WriteString("\n")
+	}
+	code.b.WriteString("\n")
+}
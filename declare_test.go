@@ -0,0 +1,83 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"strings" // strings
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// declare returns Code with a function body, which declares its imports, constant, variable, type and
+// helper function out of order. The helper function and the constant are declared twice.
+func declare() *lpcode.Code {
+	// helper is the helper function declared by the function body
+	helper := lpcode.NewCode().Ident("func helper() string { return strings.ToUpper(greeting) }\n")
+	// Return the function body and its declarations
+	return lpcode.NewCode().Ident("package mirkwood\n").
+		Ident("func Greet() { fmt.Println(helper(), count, mirkwood{}) }\n").
+		Declare(lpcode.PartFuncs, helper).Import("strings").
+		Declare(lpcode.PartTests, lpcode.NewCode().Ident("func testGreet() {}\n")).
+		Declare(lpcode.PartTypes, lpcode.NewCode().Ident("type mirkwood struct{}")).
+		Declare(lpcode.PartConsts, lpcode.NewCode().Ident("const greeting = \"hello\"\n")).
+		Import("fmt").
+		Declare(lpcode.PartVars, lpcode.NewCode().Ident("var count = 1\n")).
+		Declare(lpcode.PartFuncs, helper).
+		Declare(lpcode.PartConsts, lpcode.NewCode().Ident("\nconst greeting = \"hello\""))
+}
+
+// TestDeclare tests emitting the parts of Code in canonical Go order. The test fails if the formatted source
+// code does not match the golden file.
+func TestDeclare(t *testing.T) {
+	// Format the source code
+	c := declare()
+	if e := c.Format(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "declare", Err: e}))
+	}
+	// The test fails if the source code does not match the golden file
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "declare", Data: c.String()}); e != nil {
+		t.Error(e)
+	}
+}
+
+// TestDeclareCodefile tests writing Code with parts to a Codefile. The test fails if the imports of the Code are
+// not part of the import declaration of the Codefile or if the declarations are not in canonical order after it.
+func TestDeclareCodefile(t *testing.T) {
+	// Retrieve a new Codefile without header and generate the file
+	cf := newCodefileNamed(t, "testdata/declare.go")
+	if e := cf.StartFile(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "StartFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if _, e := cf.Import("os"); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Import", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := cf.WriteCode(declare()); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteCode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := cf.FinishFile(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "FinishFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if the imports and declarations are not in canonical order
+	f := readFile(t, cf.Filepath())
+	want := []string{"package mirkwood", "import (\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n)", "const greeting", "var count", "type mirkwood", "func Greet", "func helper", "func testGreet"}
+	for i := 1; i < len(want); i++ {
+		if a, b := strings.Index(f, want[i-1]), strings.Index(f, want[i]); a < 0 || b < a {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: f, Want: want[i-1] + " before " + want[i]}))
+		}
+	}
+}
+
+// TestDeclareNil tests Import and Declare of nil Code. The test fails if they do not return nil.
+func TestDeclareNil(t *testing.T) {
+	// Retrieve nil Code
+	var c *lpcode.Code
+	// The test fails if Import or Declare do not return nil
+	if c.Import(testKey) != nil || c.Declare(lpcode.PartConsts, lpcode.NewCode()) != nil {
+		t.Error(tserr.NotNil("Code"))
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages and tserr
+import (
+	"fmt"     // fmt
+	"io"      // io
+	"strings" // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+)
+
+// diffCostLimit is the number of edits after which the search for the shortest edit script is cut short
+const diffCostLimit = 256
+
+// diffContext is the number of unchanged lines shown before and after changes in a unified diff.
+const diffContext = 3
+
+// edit is a single line of a line diff. Kind is ' ' for an unchanged line, '-' for a deleted line of the
+// old text and '+' for an inserted line of the new text. The indexes a and b are the positions in the old and
+// new text before the edit is applied.
+type edit struct {
+	kind byte
+	a, b int
+}
+
+// diffLines returns the edit script transforming lines a into lines b using the linear space variant of the Myers
+// diff algorithm, which recursively splits the texts at the middle snake. The edit script is the shortest, unless the
+// search is cut short by diffCostLimit, so that time is bounded and memory is linear in the number of lines.
+func diffLines(a, b []string) []edit {
+	// Map the lines to integers, so that lines are compared in constant time
+	ids := make(map[string]int)
+	intern := func(ls []string) []int {
+		r := make([]int, len(ls))
+		for i, l := range ls {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			r[i] = id
+		}
+		return r
+	}
+	ia, ib := intern(a), intern(b)
+	// Discard the lines, which are not contained in the other text, since they are always deleted or inserted
+	fa, xa := shared(ia, ib)
+	fb, xb := shared(ib, ia)
+	// Retrieve the unchanged lines
+	var ms [][2]int
+	diffRange(fa, fb, 0, 0, &ms)
+	ms = append(ms, [2]int{len(fa), len(fb)})
+	// Retrieve the edit script with the deletions before the insertions of each change
+	var es []edit
+	x, y := 0, 0
+	for _, m := range ms {
+		// Retrieve the indexes of the unchanged line in a and b, the end if all lines are processed
+		ea, eb := len(a), len(b)
+		if m[0] < len(fa) {
+			ea, eb = xa[m[0]], xb[m[1]]
+		}
+		for ; x < ea; x++ {
+			es = append(es, edit{'-', x, y})
+		}
+		for ; y < eb; y++ {
+			es = append(es, edit{'+', x, y})
+		}
+		if ea < len(a) {
+			es = append(es, edit{' ', x, y})
+			x, y = x+1, y+1
+		}
+	}
+	// Return the edit script
+	return es
+}
+
+// shared returns the lines of a, which are contained in b, and their indexes in a.
+func shared(a, b []int) ([]int, []int) {
+	// Collect the lines of b
+	in := make(map[int]bool, len(b))
+	for _, l := range b {
+		in[l] = true
+	}
+	// Retrieve the lines of a contained in b
+	var r, x []int
+	for i, l := range a {
+		if in[l] {
+			r, x = append(r, l), append(x, i)
+		}
+	}
+	return r, x
+}
+
+// diffRange appends the index pairs of the unchanged lines of the shortest edit script transforming a into b to ms.
+// The lines a and b start at the indexes oa and ob.
+func diffRange(a, b []int, oa, ob int, ms *[][2]int) {
+	// Add the unchanged lines of the common prefix
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		*ms = append(*ms, [2]int{oa + p, ob + p})
+		p++
+	}
+	a, b, oa, ob = a[p:], b[p:], oa+p, ob+p
+	// Retrieve the common suffix, which is added after the changes
+	s := 0
+	for s < len(a) && s < len(b) && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	a, b = a[:len(a)-s], b[:len(b)-s]
+	// Split at the middle snake, if both texts contain lines
+	if x, y, ok := middleSnake(a, b); ok {
+		diffRange(a[:x], b[:y], oa, ob, ms)
+		diffRange(a[x:], b[y:], oa+x, ob+y, ms)
+	}
+	// Add the unchanged lines of the common suffix
+	for i := 0; i < s; i++ {
+		*ms = append(*ms, [2]int{oa + len(a) + i, ob + len(b) + i})
+	}
+}
+
+// middleSnake returns the point x, y at which the shortest edit script transforming a into b is split. The forward
+// and reverse search of the Myers diff algorithm meet at this point. If the searches do not meet within diffCostLimit
+// edits, the point reached furthest by the forward search is returned. It returns false, if a or b is empty or if a and b
+// have no line in common, so that all lines are deleted and inserted.
+func middleSnake(a, b []int) (int, int, bool) {
+	// Return false, if a or b is empty or if a and b have no line in common
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 || !common(a, b) {
+		return 0, 0, false
+	}
+	// vf and vb hold the furthest reaching x of the forward and reverse search for each diagonal k at index off+k
+	maxD := (n + m + 1) / 2
+	off := maxD
+	vf, vb := make([]int, 2*maxD+2), make([]int, 2*maxD+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[off+1], vb[off+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// Search forward and reverse until the searches overlap, the bounds skip diagonals outside the texts
+	k1lo, k1hi, k2lo, k2hi := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		// Return the furthest reaching point of the forward search, if the search is too expensive. The edit script
+		// is then not necessarily the shortest, but the diff of texts with many changes is computed in bounded time.
+		if d > diffCostLimit {
+			bx, by := 0, 0
+			for k := -d + 1 + k1lo; k <= d-1-k1hi; k += 2 {
+				if x := vf[off+k]; x >= 0 && x <= n && x-k >= 0 && x-k <= m && x+x-k > bx+by {
+					bx, by = x, x-k
+				}
+			}
+			return bx, by, bx+by > 0 && bx+by < n+m
+		}
+		// Extend the forward search
+		for k := -d + k1lo; k <= d-k1hi; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[off+k] = x
+			switch {
+			case x > n:
+				k1hi += 2
+			case y > m:
+				k1lo += 2
+			case odd:
+				// Return the point, if the forward search overlaps the reverse search
+				if kb := off + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return x, y, true
+				}
+			}
+		}
+		// Extend the reverse search
+		for k := -d + k2lo; k <= d-k2hi; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[off+k] = x
+			switch {
+			case x > n:
+				k2hi += 2
+			case y > m:
+				k2lo += 2
+			case !odd:
+				// Return the point of the forward search, if the reverse search overlaps it
+				if kf := off + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 && vf[kf] >= n-x {
+					return vf[kf], off + vf[kf] - kf, true
+				}
+			}
+		}
+	}
+	// Return false, since the searches did not meet
+	return 0, 0, false
+}
+
+// common returns true, if a and b have at least one line in common.
+func common(a, b []int) bool {
+	// Collect the lines of a
+	la := make(map[int]bool, len(a))
+	for _, l := range a {
+		la[l] = true
+	}
+	// Return true, if a line of b is a line of a
+	for _, l := range b {
+		if la[l] {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffArgs contains the old and new text and their names to generate a unified diff with WriteDiff.
+type DiffArgs struct {
+	OldName, NewName string // names of the old and new text in the file header of the unified diff
+	Old, New         []byte // old and new text
+}
+
+// WriteDiff writes the unified diff between the old and new text provided by a to w. The line diff is computed
+// with the Myers diff algorithm and each hunk contains three lines of context. Nothing is written, if the old and new
+// text are equal. It returns an error if a is nil or if writing to w fails.
+func WriteDiff(w io.Writer, a *DiffArgs) error {
+	// Return an error in case a is nil
+	if a == nil {
+		return tserr.NilPtr()
+	}
+	// Write the unified diff to w
+	if _, e := io.WriteString(w, unifiedDiff(a.OldName, a.NewName, a.Old, a.New)); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "write", Fn: "diff", Err: e})
+	}
+	// Return nil
+	return nil
+}
+
+// unifiedDiff returns the unified diff between the old text a and the new text b named na and nb.
+// It returns an empty string, if a and b are equal.
+func unifiedDiff(na, nb string, a, b []byte) string {
+	// Return an empty string, if a and b are equal
+	if string(a) == string(b) {
+		return ""
+	}
+	// Split the texts into lines
+	la, lb := splitLines(string(a)), splitLines(string(b))
+	// Retrieve the edit script
+	es := diffLines(la, lb)
+	// Write the file header
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %v\n+++ %v\n", na, nb)
+	// Write the hunks
+	for i := 0; i < len(es); {
+		// Skip unchanged lines
+		if es[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Retrieve the start of the hunk including the preceding context
+		start := max(i-diffContext, 0)
+		// Retrieve the end of the hunk: the hunk ends if more than twice the context of unchanged lines follow
+		end, same := i, 0
+		for j := i; j < len(es) && same <= 2*diffContext; j++ {
+			if es[j].kind == ' ' {
+				same++
+			} else {
+				same, end = 0, j+1
+			}
+		}
+		end = min(end+diffContext, len(es))
+		// Write the hunk
+		writeHunk(&sb, la, lb, es[start:end])
+		i = end
+	}
+	// Return the unified diff
+	return sb.String()
+}
+
+// writeHunk writes the hunk with the edits es of old lines a and new lines b to sb.
+func writeHunk(sb *strings.Builder, a, b []string, es []edit) {
+	// Count the lines of the old and new text in the hunk
+	ca, cb := 0, 0
+	for _, e := range es {
+		if e.kind != '+' {
+			ca++
+		}
+		if e.kind != '-' {
+			cb++
+		}
+	}
+	// Retrieve the first line numbers, which refer to the preceding line for empty ranges
+	la, lb := es[0].a+1, es[0].b+1
+	if ca == 0 {
+		la--
+	}
+	if cb == 0 {
+		lb--
+	}
+	// Write the hunk header
+	fmt.Fprintf(sb, "@@ -%v +%v @@\n", hunkRange(la, ca), hunkRange(lb, cb))
+	// Write the lines
+	for _, e := range es {
+		l := ""
+		switch e.kind {
+		case '+':
+			l = b[e.b]
+		default:
+			l = a[e.a]
+		}
+		sb.WriteByte(e.kind)
+		sb.WriteString(l)
+		if !strings.HasSuffix(l, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits s into lines including their line endings.
+func splitLines(s string) []string {
+	// Return nil for an empty string
+	if s == "" {
+		return nil
+	}
+	// Split s after each new line
+	l := strings.SplitAfter(s, "\n")
+	// Remove the empty string after the last new line
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	// Return the lines
+	return l
+}
+
+// hunkRange returns the range of a hunk header starting at line s with c lines. The count is omitted, if it is one.
+func hunkRange(s, c int) string {
+	// Omit the count, if it is one
+	if c == 1 {
+		return fmt.Sprint(s)
+	}
+	// Return the start line and count
+	return fmt.Sprintf("%d,%d", s, c)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"bytes"     // bytes
+	"fmt"       // fmt
+	"io"        // io
+	"math/rand" // rand
+	"strconv"   // strconv
+	"strings"   // strings
+	"testing"   // testing
+	"time"      // time
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// TestWriteDiff tests the unified diff written by WriteDiff for texts with changes at the beginning, in
+// the middle and at the end without new line. The test fails if the unified diff does not match the contents
+// of the golden file.
+func TestWriteDiff(t *testing.T) {
+	// Declare the old and new text
+	o := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15"
+	n := "0\n1\n2\n3\n4\n5\n6\nseven\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	// Write the unified diff to a buffer
+	var b bytes.Buffer
+	if e := lpcode.WriteDiff(&b, &lpcode.DiffArgs{OldName: "a/" + testKey, NewName: "b/" + testKey, Old: []byte(o), New: []byte(n)}); e != nil {
+		// The test fails if WriteDiff returns an error
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteDiff", Fn: testKey, Err: e}))
+	}
+	// The test fails if the unified diff does not match the contents of the golden file
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "diff", Data: b.String()}); e != nil {
+		t.Error(e)
+	}
+}
+
+// TestWriteDiffEqual tests WriteDiff to write nothing for equal texts. The test fails
+// if WriteDiff writes a unified diff.
+func TestWriteDiffEqual(t *testing.T) {
+	// Write the unified diff of equal texts to a buffer
+	var b bytes.Buffer
+	if e := lpcode.WriteDiff(&b, &lpcode.DiffArgs{Old: []byte(testComment), New: []byte(testComment)}); e != nil || b.Len() != 0 {
+		// The test fails if WriteDiff returns an error or writes a unified diff
+		t.Error(tserr.NotEmpty("diff"))
+	}
+}
+
+// TestWriteDiffNil tests WriteDiff to return an error in case
+// a is nil. The test fails if WriteDiff does not return an error.
+func TestWriteDiffNil(t *testing.T) {
+	// The test fails if WriteDiff does not return an error.
+	if e := lpcode.WriteDiff(io.Discard, nil); e == nil {
+		t.Error(tserr.NilFailed("WriteDiff"))
+	}
+}
+
+// TestWriteDiffLarge tests WriteDiff for a large file, which is entirely rewritten. The test fails if WriteDiff
+// takes longer than ten seconds or the unified diff does not delete all old lines and insert all new lines.
+func TestWriteDiffLarge(t *testing.T) {
+	// Declare the old and new text with 20000 different lines each
+	var o, n strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&o, "old %d\n", i)
+		fmt.Fprintf(&n, "new %d\n", i)
+	}
+	// Write the unified diff to a buffer
+	var b bytes.Buffer
+	s := time.Now()
+	if e := lpcode.WriteDiff(&b, &lpcode.DiffArgs{Old: []byte(o.String()), New: []byte(n.String())}); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteDiff", Fn: "large", Err: e}))
+	}
+	// The test fails if WriteDiff takes longer than ten seconds
+	if d := time.Since(s); d > 10*time.Second {
+		t.Error(tserr.Lower(&tserr.LowerArgs{Var: "duration of WriteDiff in seconds", Actual: int64(d.Seconds()), Want: 10}))
+	}
+	// The test fails if the unified diff does not delete all old lines and insert all new lines
+	if a := strings.Count(b.String(), "\n-old"); a != 20000 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "deleted lines", Actual: int64(a), Want: 20000}))
+	}
+	if a := strings.Count(b.String(), "\n+new"); a != 20000 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "inserted lines", Actual: int64(a), Want: 20000}))
+	}
+}
+
+// TestWriteDiffApply tests the unified diff written by WriteDiff for randomly changed texts and for unrelated texts
+// with many changes. The test fails if applying the unified diff to the old text does not result in the new text.
+func TestWriteDiffApply(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		// Declare the old text and a new text with lines randomly deleted, changed and inserted
+		var o, n []string
+		for j := 0; j < 200; j++ {
+			l := strconv.Itoa(r.Intn(20)) + "\n"
+			o = append(o, l)
+			switch r.Intn(6) {
+			case 0:
+			case 1:
+				n = append(n, "changed\n")
+			case 2:
+				n = append(n, l, "inserted\n")
+			default:
+				n = append(n, l)
+			}
+		}
+		// Replace the new text with an unrelated text in the first run
+		if i == 0 {
+			n = nil
+			for j := 0; j < 5000; j++ {
+				n = append(n, strconv.Itoa(r.Intn(20))+"\n")
+			}
+		}
+		// Write the unified diff to a buffer
+		var b bytes.Buffer
+		if e := lpcode.WriteDiff(&b, &lpcode.DiffArgs{Old: []byte(strings.Join(o, "")), New: []byte(strings.Join(n, ""))}); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteDiff", Fn: "random", Err: e}))
+		}
+		// The test fails if applying the unified diff does not result in the new text
+		if a, w := applyDiff(o, b.String()), strings.Join(n, ""); a != w {
+			t.Fatal(tserr.EqualStr(&tserr.EqualStrArgs{Var: "patched text", Actual: a, Want: w}))
+		}
+	}
+}
+
+// applyDiff returns the text resulting from applying the unified diff d to the lines o.
+func applyDiff(o []string, d string) string {
+	var r []string
+	i := 0
+	for _, l := range strings.SplitAfter(d, "\n") {
+		switch {
+		case strings.HasPrefix(l, "---"), strings.HasPrefix(l, "+++"), l == "":
+		case strings.HasPrefix(l, "@@"):
+			// Copy the unchanged lines before the hunk
+			s, _, _ := strings.Cut(strings.TrimPrefix(l, "@@ -"), ",")
+			s, _, _ = strings.Cut(s, " ")
+			k, _ := strconv.Atoi(s)
+			for ; i < k-1; i++ {
+				r = append(r, o[i])
+			}
+		case l[0] == ' ':
+			r = append(r, o[i])
+			i++
+		case l[0] == '-':
+			i++
+		case l[0] == '+':
+			r = append(r, l[1:])
+		}
+	}
+	// Copy the unchanged lines after the last hunk
+	return strings.Join(append(r, o[i:]...), "")
+}
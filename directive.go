@@ -0,0 +1,251 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages and tserr
+import (
+	"errors"              // errors
+	"go/build/constraint" // constraint
+	"io/fs"               // fs
+	"path"                // path
+	"regexp"              // regexp
+	"slices"              // slices
+	"strconv"             // strconv
+	"strings"             // strings
+	"unicode"             // unicode
+
+	"github.com/thorstenrie/tserr" // tserr
+)
+
+// directive matches a compiler or tool directive without the leading comment marker
+var directive = regexp.MustCompile(`^(line |extern |export |[a-z0-9]+:[a-z0-9])`)
+
+// BuildConstraint adds the build constraint expr in boolean syntax to code, for example linux && (amd64 || arm64).
+// The build constraint is emitted as //go:build line before the package clause and its doc comment. Multiple build
+// constraints are combined with &&. If expr is not a valid build constraint, it is not added and Format returns an error.
+// It returns nil, if code is nil.
+func (code *Code) BuildConstraint(expr string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Record an error, if expr contains non-printable runes or is not a valid build constraint
+	e := tserr.NonPrintable(expr)
+	if printable(expr) {
+		_, e = constraint.Parse("//go:build " + expr)
+	}
+	if e != nil {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "BuildConstraint", Fn: expr, Err: e}))
+		return code
+	}
+	// Add the build constraint, if it is not added yet
+	if !slices.Contains(code.cons, expr) {
+		code.cons = append(code.cons, expr)
+	}
+	// Return code
+	return code
+}
+
+// GoGenerate adds a go:generate directive with command cmd and a new line to code: //go:generate cmd\n.
+// If cmd is empty or contains non-printable runes, the directive is not added and Format returns an error.
+// It returns nil, if code is nil.
+func (code *Code) GoGenerate(cmd string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Record an error, if cmd is empty or invalid
+	e := tserr.Empty("go:generate command")
+	if strings.TrimSpace(cmd) != "" {
+		e = validDirective("go:generate " + cmd)
+	}
+	if e != nil {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "GoGenerate", Fn: cmd, Err: e}))
+		return code
+	}
+	// Add the directive
+	code.add("GoGenerate", "//go:generate ", cmd, "\n")
+	// Return code
+	return code
+}
+
+// Directive attaches the directive d without the leading comment marker, for example go:noinline, to the next
+// declaration added to code by TypeStruct, Func1, VarSpec or Testvariables. The directive follows the doc comment
+// set with Doc. If d is not a valid directive, it is not attached and Format returns an error. It returns nil, if code is nil.
+func (code *Code) Directive(d string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Attach the directive, if it is valid
+	code.directive("Directive", d)
+	// Return code
+	return code
+}
+
+// NoInline attaches the directive go:noinline to the next function declaration added to code.
+// It returns nil, if code is nil.
+func (code *Code) NoInline() *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Attach the directive
+	code.directive("NoInline", "go:noinline")
+	// Return code
+	return code
+}
+
+// NoLint attaches the directive nolint to the next declaration added to code, which suppresses the findings of linters
+// in the declaration. If linters is empty, the findings of all linters are suppressed. It returns nil, if code is nil.
+func (code *Code) NoLint(linters ...string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Retrieve the linters, all linters if none are provided
+	l := "all"
+	if len(linters) > 0 {
+		l = strings.Join(linters, ",")
+	}
+	// Attach the directive
+	code.directive("NoLint", "nolint:"+l)
+	// Return code
+	return code
+}
+
+// Embed attaches the directive go:embed with patterns to the next variable declaration added to code. Patterns containing
+// spaces or quotes are quoted. If a pattern is not a valid embed pattern, the directive is not attached and Format returns
+// an error. It returns nil, if code is nil.
+func (code *Code) Embed(patterns ...string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Record an error, if a pattern is invalid
+	if e := validEmbed(patterns); e != nil {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "Embed", Fn: strings.Join(patterns, " "), Err: e}))
+		return code
+	}
+	// Attach the directive with the patterns, quoted if necessary
+	ps := make([]string, len(patterns))
+	for i, p := range patterns {
+		ps[i] = p
+		if strings.ContainsAny(p, " \"`") {
+			ps[i] = strconv.Quote(p)
+		}
+	}
+	code.directive("Embed", "go:embed "+strings.Join(ps, " "))
+	// Return code
+	return code
+}
+
+// BlockComment adds a general comment with text c and a new line to code: /* c */\n. If c spans multiple lines,
+// the comment markers are placed on their own lines. If c contains */, the comment is not added and Format returns
+// an error. It returns nil, if code is nil.
+func (code *Code) BlockComment(c string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Record an error, if c terminates the comment
+	if strings.Contains(c, "*/") {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "BlockComment", Fn: c, Err: tserr.Forbidden("*/ in block comment")}))
+		return code
+	}
+	// Add the general comment
+	if strings.Contains(c, "\n") {
+		code.add("BlockComment", "/*\n", strings.TrimSuffix(c, "\n"), "\n*/\n")
+	} else {
+		code.add("BlockComment", "/* ", c, " */\n")
+	}
+	// Return code
+	return code
+}
+
+// directive attaches directive d to the next declaration added to code, if d is valid.
+// Otherwise, it records an error for builder call op.
+func (code *Code) directive(op, d string) {
+	// Record an error, if d is invalid
+	if e := validDirective(d); e != nil {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: op, Fn: d, Err: e}))
+		return
+	}
+	// Attach the directive
+	code.dirs += "//" + d + "\n"
+}
+
+// validDirective returns an error, if d is not a valid directive.
+func validDirective(d string) error {
+	// Return an error, if d contains non-printable runes
+	if !printable(d) {
+		return tserr.NonPrintable(d)
+	}
+	// Return an error, if d is not a directive
+	if !directive.MatchString(d) {
+		return tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: d, Want: "directive"})
+	}
+	// Return nil
+	return nil
+}
+
+// validEmbed returns an error, if patterns is empty or contains a pattern, which is not a valid embed pattern.
+func validEmbed(patterns []string) error {
+	// Return an error, if patterns is empty
+	if len(patterns) == 0 {
+		return tserr.Empty("embed patterns")
+	}
+	for _, p := range patterns {
+		// Return an error, if the pattern contains non-printable runes
+		if !printable(p) {
+			return tserr.NonPrintable(p)
+		}
+		// Return an error, if the pattern is not a valid, unrooted path or has an invalid syntax
+		q := strings.TrimPrefix(p, "all:")
+		if _, e := path.Match(q, ""); e != nil || !fs.ValidPath(q) || q == "." {
+			return tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: p, Want: "embed pattern"})
+		}
+	}
+	// Return nil
+	return nil
+}
+
+// printable returns true, if s only contains printable runes.
+func printable(s string) bool {
+	// Return false, if a rune is not printable
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	// Return true
+	return true
+}
+
+// buildLine returns the //go:build line combining the build constraints of code. It returns an empty string,
+// if code has no build constraints.
+func (code *Code) buildLine() string {
+	// Return an empty string, if code has no build constraints
+	if len(code.cons) == 0 {
+		return ""
+	}
+	// Combine the build constraints with &&
+	var x constraint.Expr
+	for _, c := range code.cons {
+		y, _ := constraint.Parse("//go:build " + c)
+		if x == nil {
+			x = y
+		} else {
+			x = &constraint.AndExpr{X: x, Y: y}
+		}
+	}
+	// Return the build line
+	return "//go:build " + x.String() + "\n\n"
+}
+
+// invalid returns an error joining the errors of invalid directives added to code. It returns nil, if all directives are valid.
+func (code *Code) invalid() error {
+	// Return the joined errors
+	return errors.Join(code.errs...)
+}
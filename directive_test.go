@@ -0,0 +1,86 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library package testing as well as lpcode and tserr
+import (
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestDirective tests build constraints, directives attached to declarations and block comments.
+// The test fails if Format returns an error or the formatted source code differs from the expected source code.
+func TestDirective(t *testing.T) {
+	// Generate a file with build constraints, a package doc comment, directives and a block comment
+	c := lpcode.NewCode().Ident("// Code generated. DO NOT EDIT.\n\n// Package " + testKey + " is generated.\npackage " + testKey + "\n\n")
+	c.BuildConstraint("linux || darwin").BuildConstraint("amd64").GoGenerate("go run gen.go").BlockComment("first\nsecond")
+	c.Doc(lpcode.NewDoc().Paragraph("Foo returns x.")).NoInline().NoLint("unused", "gocritic")
+	c.Func1(&lpcode.Func1Args{Name: "Foo", Var: "x", Type: "int", Return: "int"}).Return().Ident("x\n").FuncEnd()
+	// The test fails if Format returns an error
+	if e := c.Format(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "directives", Err: e}))
+	}
+	// The test fails if the formatted source code differs from the expected source code
+	want := "// Code generated. DO NOT EDIT.\n\n//go:build (linux || darwin) && amd64\n\n// Package " + testKey + " is generated.\npackage " +
+		testKey + "\n\n//go:generate go run gen.go\n/*\nfirst\nsecond\n*/\n// Foo returns x.\n//\n//go:noinline\n//nolint:unused,gocritic\n" +
+		"func Foo(x int) int {\n\treturn x\n}\n"
+	if a := c.String(); a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "directives", Actual: a, Want: want}))
+	}
+}
+
+// TestDirectiveErr tests Format to return an error for invalid build constraints, directives, embed patterns and
+// block comments. The test fails if Format returns nil or if an invalid directive is emitted.
+func TestDirectiveErr(t *testing.T) {
+	// Declare the invalid directives
+	tcs := map[string]func(*lpcode.Code) *lpcode.Code{
+		"BuildConstraint": func(c *lpcode.Code) *lpcode.Code { return c.BuildConstraint("linux &&") },
+		"BuildLine":       func(c *lpcode.Code) *lpcode.Code { return c.BuildConstraint("linux\npackage x") },
+		"GoGenerate":      func(c *lpcode.Code) *lpcode.Code { return c.GoGenerate(" ") },
+		"Directive":       func(c *lpcode.Code) *lpcode.Code { return c.Directive("noinline") },
+		"Embed":           func(c *lpcode.Code) *lpcode.Code { return c.Embed("../secret.txt") },
+		"EmbedRooted":     func(c *lpcode.Code) *lpcode.Code { return c.Embed("/etc/passwd") },
+		"EmbedPattern":    func(c *lpcode.Code) *lpcode.Code { return c.Embed("[a-") },
+		"EmbedEmpty":      func(c *lpcode.Code) *lpcode.Code { return c.Embed() },
+		"BlockComment":    func(c *lpcode.Code) *lpcode.Code { return c.BlockComment("a */ b") },
+	}
+	for n, tc := range tcs {
+		// The test fails if Format returns nil
+		c := tc(lpcode.NewCode().Ident("package " + testKey + "\n"))
+		if e := c.Format(); e == nil {
+			t.Error(tserr.NilFailed(n))
+		}
+		// The test fails if the invalid directive is emitted
+		if a := c.String(); a != "package "+testKey+"\n" {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: n, Actual: a, Want: "package " + testKey + "\n"}))
+		}
+	}
+}
+
+// TestDirectiveRollback tests Rollback to discard build constraints and errors of invalid directives added after Mark.
+// The test fails if Format returns an error after Rollback.
+func TestDirectiveRollback(t *testing.T) {
+	// Add an invalid directive and a build constraint after a snapshot
+	c := lpcode.NewCode().Ident("package " + testKey + "\n")
+	m := c.Mark()
+	c.Directive("invalid").BuildConstraint("linux")
+	// The test fails if Format returns an error after Rollback
+	if e := c.Rollback(m).Format(); e != nil || c.String() != "package "+testKey+"\n" {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "Rollback", Err: e}))
+	}
+}
+
+// TestDirectiveNil tests the directive builders to return nil in case *Code is nil.
+// The test fails if a builder does not return nil.
+func TestDirectiveNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if a builder does not return nil
+	if c.BuildConstraint("") != nil || c.GoGenerate("") != nil || c.Directive("") != nil || c.NoInline() != nil ||
+		c.NoLint() != nil || c.Embed() != nil || c.BlockComment("") != nil {
+		t.Error(tserr.NotNil("directive builder"))
+	}
+}
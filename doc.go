@@ -0,0 +1,294 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"strconv" // strconv
+	"strings" // strings
+)
+
+// DefaultDocWidth is the default column at which Doc wraps its text.
+const DefaultDocWidth = 80
+
+// docKind is the kind of a block of Doc
+type docKind int
+
+// Kinds of blocks of Doc
+const (
+	docParagraph docKind = iota // paragraph
+	docHeading                  // heading
+	docList                     // bulleted list
+	docNumbered                 // numbered list
+	docCode                     // code block
+)
+
+// docBlock is a block of Doc
+type docBlock struct {
+	kind docKind  // kind of the block
+	text []string // text of the paragraph or heading, items of the list or lines of the code block
+}
+
+// Doc is a doc comment in godoc syntax. It consists of paragraphs, headings, lists and code blocks,
+// which are separated by empty comment lines. The text of paragraphs and list items is wrapped at the
+// column set by Width. Doc links like [Name] or [pkg.Name] in the text are not split. A wrapped line never
+// starts with a heading or list marker like #, - or 1., so that godoc does not render the text as heading
+// or list item. A Doc is attached to the next declaration added to Code with Doc.
+type Doc struct {
+	w     int        // column at which the text is wrapped
+	bs    []docBlock // blocks of the doc comment
+	links []string   // link definitions
+}
+
+// NewDoc returns a pointer to a new, empty Doc, which wraps its text at DefaultDocWidth.
+func NewDoc() *Doc {
+	// Return a new Doc
+	return &Doc{w: DefaultDocWidth}
+}
+
+// Width sets the column w at which the text of d is wrapped, including the comment marker.
+// Words longer than the line are not split. Width leaves d unchanged, if w is not positive.
+// It returns nil, if d is nil.
+func (d *Doc) Width(w int) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Set the column, if it is positive
+	if w > 0 {
+		d.w = w
+	}
+	// Return d
+	return d
+}
+
+// Paragraph adds a paragraph with text s to d. Line breaks and white space in s are
+// normalized, so that no line starts with a tab, the text is wrapped. If s starts with the
+// heading marker #, the marker is kept on a line of its own, so that godoc does not render
+// the paragraph as heading. It returns nil, if d is nil.
+func (d *Doc) Paragraph(s string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the paragraph
+	d.bs = append(d.bs, docBlock{kind: docParagraph, text: []string{s}})
+	// Return d
+	return d
+}
+
+// Heading adds a godoc heading with text s to d: # s. The heading is not wrapped.
+// It returns nil, if d is nil.
+func (d *Doc) Heading(s string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the heading
+	d.bs = append(d.bs, docBlock{kind: docHeading, text: []string{s}})
+	// Return d
+	return d
+}
+
+// List adds a bulleted list with items to d. The text of each item is wrapped. A list directly followed by
+// another list or a code block is merged with it by godoc, so they need to be separated by a paragraph.
+// It returns nil, if d is nil.
+func (d *Doc) List(items ...string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the list
+	d.bs = append(d.bs, docBlock{kind: docList, text: items})
+	// Return d
+	return d
+}
+
+// NumberedList adds a numbered list with items to d. The items are numbered starting with 1.
+// The text of each item is wrapped. It returns nil, if d is nil.
+func (d *Doc) NumberedList(items ...string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the numbered list
+	d.bs = append(d.bs, docBlock{kind: docNumbered, text: items})
+	// Return d
+	return d
+}
+
+// CodeBlock adds a code block with source code s to d. The lines of s are indented with
+// a tab and not wrapped. It returns nil, if d is nil.
+func (d *Doc) CodeBlock(s string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the code block
+	d.bs = append(d.bs, docBlock{kind: docCode, text: strings.Split(strings.TrimRight(s, "\n"), "\n")})
+	// Return d
+	return d
+}
+
+// Link adds the link definition [text]: url to d, so that [text] in the doc comment links to url.
+// Link definitions are emitted at the end of the doc comment. It returns nil, if d is nil.
+func (d *Doc) Link(text, url string) *Doc {
+	// Return nil in case d is nil
+	if d == nil {
+		return nil
+	}
+	// Add the link definition
+	d.links = append(d.links, "["+text+"]: "+url)
+	// Return d
+	return d
+}
+
+// Deprecated adds a paragraph to d, which marks the declaration as deprecated: Deprecated: s.
+// It returns nil, if d is nil.
+func (d *Doc) Deprecated(s string) *Doc {
+	// Return d with the paragraph
+	return d.Paragraph("Deprecated: " + s)
+}
+
+// String returns the doc comment d as line comments. It returns an empty string, if d is nil or empty.
+func (d *Doc) String() string {
+	// Return an empty string in case d is nil
+	if d == nil {
+		return ""
+	}
+	// Render the blocks separated by empty comment lines
+	var ls []string
+	for _, b := range d.bs {
+		if len(ls) > 0 {
+			ls = append(ls, "//")
+		}
+		switch b.kind {
+		case docParagraph:
+			// Keep a leading heading marker on a line of its own
+			if ws := docWords(b.text[0]); len(ws) > 1 && ws[0] == "#" {
+				ls = append(ls, "// #")
+				ls = append(ls, d.wrap(strings.Join(ws[1:], " "), "// ", "// ")...)
+			} else {
+				ls = append(ls, d.wrap(b.text[0], "// ", "// ")...)
+			}
+		case docHeading:
+			ls = append(ls, "// # "+strings.Join(strings.Fields(b.text[0]), " "))
+		case docList, docNumbered:
+			for i, it := range b.text {
+				m := "  - "
+				if b.kind == docNumbered {
+					m = " " + strconv.Itoa(i+1) + ". "
+				}
+				ls = append(ls, d.wrap(it, "// "+m, "//     ")...)
+			}
+		case docCode:
+			for _, l := range b.text {
+				if strings.TrimSpace(l) == "" {
+					ls = append(ls, "//")
+				} else {
+					ls = append(ls, "//\t"+l)
+				}
+			}
+		}
+	}
+	// Render the link definitions
+	for i, l := range d.links {
+		if i == 0 && len(ls) > 0 {
+			ls = append(ls, "//")
+		}
+		ls = append(ls, "// "+l)
+	}
+	// Return an empty string, if d is empty
+	if len(ls) == 0 {
+		return ""
+	}
+	// Return the doc comment
+	return strings.Join(ls, "\n") + "\n"
+}
+
+// wrap returns the words of s as lines wrapped at the column of d. The first line starts with p, all other lines with c.
+// Doc links are not split and markers are not wrapped to the start of a line.
+func (d *Doc) wrap(s, p, c string) []string {
+	var ls []string
+	l, n := p, 0
+	for _, w := range docWords(s) {
+		// Start a new line, if the word does not fit into the current line
+		if n > 0 && len(l)+1+len(w) > d.w {
+			ls = append(ls, l)
+			l, n = c, 0
+		}
+		// Append the word to the line
+		if n > 0 {
+			l += " "
+		}
+		l += w
+		n++
+	}
+	// Return the lines
+	return append(ls, l)
+}
+
+// docWords returns the words of s. The words of a doc link in square brackets are joined to a single word.
+// A heading or list marker is joined to the previous word.
+func docWords(s string) []string {
+	var ws []string
+	open := false
+	for _, w := range strings.Fields(s) {
+		// Join the word to the doc link, if a doc link is open, or to the previous word, if it is a marker
+		if open || (len(ws) > 0 && docMarker(w)) {
+			ws[len(ws)-1] += " " + w
+		} else {
+			ws = append(ws, w)
+		}
+		// Retrieve whether a doc link is open after the word
+		if i := strings.LastIndex(w, "["); i >= 0 {
+			open = !strings.Contains(w[i:], "]")
+		} else if open {
+			open = !strings.Contains(w, "]")
+		}
+	}
+	return ws
+}
+
+// docMarker returns true, if word w is a heading marker, a list marker or a numbered list marker of godoc,
+// for example #, -, * or 1.
+func docMarker(w string) bool {
+	// Return true, if w is a heading or list marker
+	switch w {
+	case "#", "-", "*", "+", "•":
+		return true
+	}
+	// Return true, if w is a number followed by . or )
+	l := len(w) - 1
+	return l > 0 && (w[l] == '.' || w[l] == ')') && strings.Trim(w[:l], "0123456789") == ""
+}
+
+// Doc attaches the doc comment d to the next declaration added to code by TypeStruct, Func1, VarSpec or
+// Testvariables. A later call of Doc replaces a doc comment not yet attached. It returns nil, if code is nil.
+func (code *Code) Doc(d *Doc) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Keep the doc comment for the next declaration
+	code.doc = d.String()
+	// Return code
+	return code
+}
+
+// attach adds the doc comment kept by Doc and the directives kept by Directive to code.
+func (code *Code) attach() {
+	// Add the doc comment, if one is kept
+	if code.doc != "" {
+		code.add("Doc", code.doc)
+	}
+	// Add the directives separated from the doc comment by an empty comment line, if directives are kept
+	if code.dirs != "" {
+		if code.doc != "" {
+			code.add("Directive", "//\n")
+		}
+		code.add("Directive", code.dirs)
+	}
+	code.doc, code.dirs = "", ""
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"fmt"            // fmt
+	"go/doc/comment" // comment
+	"strings"        // strings
+	"testing"        // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// testDoc returns a doc comment with the text of the golden file loremipsum, a heading, lists, a code block,
+// a doc link and a deprecation notice.
+func testDoc(t *testing.T) *lpcode.Doc {
+	// Retrieve the contents of the golden file loremipsum
+	fn, err := tsfio.GoldenFilePath("loremipsum")
+	if err != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "GoldenFilePath", Fn: "loremipsum", Err: err}))
+	}
+	li, err := tsfio.ReadFile(fn)
+	if err != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fn), Err: err}))
+	}
+	// Return the doc comment
+	return lpcode.NewDoc().Paragraph(testStruct+" is a struct. "+string(li)).Heading("Usage").
+		List("Create the struct with [NewCode] and add source code with [Code.Ident].", string(li)).
+		Paragraph("Then write the source code:").NumberedList("Format the source code.", "Write the [Go home page] to a file.").
+		Paragraph("For example:").CodeBlock("c := lpcode.NewCode()\n\nc.Format()\n").Link("Go home page", "https://go.dev").
+		Deprecated("Use [Code] instead.")
+}
+
+// TestDoc tests a doc comment attached to a type declaration with Doc. The test fails if the lines of the doc comment
+// exceed the width, if gofmt changes the doc comment or if the source code does not match the contents of the golden file.
+func TestDoc(t *testing.T) {
+	// Retrieve the type declaration with the doc comment
+	c := lpcode.NewCode().Ident("package " + testKey + "\n\n").Doc(testDoc(t)).TypeStruct(testStruct).BlockEnd()
+	src := c.String()
+	// The test fails if a wrapped line exceeds the width
+	for _, l := range strings.Split(src, "\n") {
+		if len(l) > lpcode.DefaultDocWidth && strings.Count(l, " ") > 2 && !strings.HasPrefix(l, "//\t") {
+			t.Error(tserr.Lower(&tserr.LowerArgs{Var: "length of " + l, Actual: int64(len(l)), Want: lpcode.DefaultDocWidth}))
+		}
+	}
+	// The test fails if Format returns an error or the source code does not match the contents of the golden file
+	if e := evalCode(c, "doc"); e != nil {
+		t.Error(e)
+	}
+	// The test fails if gofmt changes the doc comment
+	if a := c.String(); a != src {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "formatted doc comment", Actual: a, Want: src}))
+	}
+}
+
+// TestDocWidth tests Width to wrap the text of a doc comment at the given column without splitting doc links.
+// The test fails if the doc comment differs from the expected doc comment.
+func TestDocWidth(t *testing.T) {
+	// Retrieve a doc comment wrapped at column 20
+	a := lpcode.NewDoc().Width(20).Paragraph("See the [Go home page] for a tour.").List("one two three four").String()
+	// The test fails if the doc comment differs from the expected doc comment
+	want := "// See the\n// [Go home page]\n// for a tour.\n//\n//   - one two three\n//     four\n"
+	if a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "doc comment", Actual: a, Want: want}))
+	}
+}
+
+// TestDocMarkers tests Doc to keep heading and list markers from the start of wrapped lines, so that godoc renders
+// paragraphs and list items as written. The test fails if the doc comment differs from the expected doc comment
+// or if godoc parses other blocks than a paragraph, a paragraph and a list with a single item.
+func TestDocMarkers(t *testing.T) {
+	// Retrieve a doc comment wrapped at column 20 with markers in its text
+	a := lpcode.NewDoc().Width(20).Paragraph("# not a heading").Paragraph("one two three - four 1. five\tsix").
+		List("a b c - d e 2. f").String()
+	// The test fails if the doc comment differs from the expected doc comment
+	want := "// #\n// not a heading\n//\n// one two three -\n// four 1. five six\n//\n//   - a b c - d\n//     e 2. f\n"
+	if a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "doc comment", Actual: a, Want: want}))
+	}
+	// The test fails if godoc parses other blocks than expected
+	var p comment.Parser
+	d := p.Parse(strings.ReplaceAll(strings.ReplaceAll(a, "// ", ""), "//", ""))
+	var bs []string
+	for _, b := range d.Content {
+		bs = append(bs, fmt.Sprintf("%T", b))
+		if l, ok := b.(*comment.List); ok {
+			bs = append(bs, fmt.Sprint(len(l.Items)))
+		}
+	}
+	if s, w := strings.Join(bs, " "), "*comment.Paragraph *comment.Paragraph *comment.List 1"; s != w {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "blocks", Actual: s, Want: w}))
+	}
+}
+
+// TestDocAttach tests Doc to attach the doc comment to the next declaration only. The test fails if the doc comment
+// is not emitted before the declaration or is emitted twice.
+func TestDocAttach(t *testing.T) {
+	// Attach the doc comment to a function
+	c := lpcode.NewCode().Doc(lpcode.NewDoc().Paragraph("Foo returns x.")).Ident("\n")
+	c.Func1(&lpcode.Func1Args{Name: "Foo", Var: "x", Type: "int", Return: "int"}).Return().Ident("x\n").FuncEnd()
+	c.Func1(&lpcode.Func1Args{Name: "Bar", Var: "x", Type: "int", Return: "int"}).Return().Ident("x\n").FuncEnd()
+	// The test fails if the doc comment is not emitted before the declaration or is emitted twice
+	if a, w := c.String(), "\n// Foo returns x.\nfunc Foo(x int) int {\n"; !strings.HasPrefix(a, w) || strings.Count(a, "//") != 1 {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "doc comment", Actual: a, Want: w}))
+	}
+}
+
+// TestDocNil tests Doc and the methods of Doc to return nil in case they are called on nil.
+// The test fails if a method does not return nil.
+func TestDocNil(t *testing.T) {
+	// Declare c as type *Code and d as type *Doc and assign nil
+	var (
+		c *lpcode.Code = nil
+		d *lpcode.Doc  = nil
+	)
+	// The test fails if a method does not return nil
+	if c.Doc(nil) != nil || d.Width(1) != nil || d.Paragraph("") != nil || d.Heading("") != nil || d.List() != nil ||
+		d.NumberedList() != nil || d.CodeBlock("") != nil || d.Link("", "") != nil || d.Deprecated("") != nil || d.String() != "" {
+		t.Error(tserr.NotNil("Doc"))
+	}
+}
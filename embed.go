@@ -0,0 +1,188 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"errors"        // errors
+	"io/fs"         // fs
+	"path"          // path
+	"path/filepath" // filepath
+	"strconv"       // strconv
+	"strings"       // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// EmbedType is the type of a variable generated by EmbedVar.
+type EmbedType int
+
+// Types of variables generated by EmbedVar
+const (
+	// EmbedString is a string holding the contents of a single file.
+	EmbedString EmbedType = iota
+	// EmbedBytes is a byte slice holding the contents of a single file.
+	EmbedBytes
+	// EmbedFS is an embed.FS holding a tree of files.
+	EmbedFS
+)
+
+// embedTypes contains the Go types of the embed types
+var embedTypes = [...]string{EmbedString: "string", EmbedBytes: "[]byte", EmbedFS: "embed.FS"}
+
+// EmbedVarArgs contains the identifier Ident, the type Type and the embed patterns Patterns
+// to generate a variable with embedded files with EmbedVar.
+type EmbedVarArgs struct {
+	Ident    string
+	Type     EmbedType
+	Patterns []string
+}
+
+// embedSpec contains the patterns of a variable generated by EmbedVar
+type embedSpec struct {
+	patterns []string // embed patterns
+	file     bool     // true, if the patterns must match a single file
+}
+
+// EmbedVar adds a variable declaration with a go:embed directive to code: //go:embed Patterns\nvar Ident Type\n.
+// The embed import is registered. If the Code is written to a Codefile, FinishFile verifies that the patterns match
+// files in the directory of the Codefile in its filesystem and, for EmbedString and EmbedBytes, that they match exactly one file.
+// If a pattern is not a valid embed pattern or Type is invalid, Format returns an error. It returns nil, if code or a is nil.
+func (code *Code) EmbedVar(a *EmbedVarArgs) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Return nil in case a is nil
+	if a == nil {
+		return nil
+	}
+	// Record an error, if the type is invalid
+	if a.Type < EmbedString || a.Type > EmbedFS {
+		code.errs = append(code.errs, tserr.Op(&tserr.OpArgs{Op: "EmbedVar", Fn: a.Ident,
+			Err: tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: strconv.Itoa(int(a.Type)), Want: "EmbedType"})}))
+		return code
+	}
+	// Register the embed import, only for its side effects for strings and byte slices
+	if a.Type == EmbedFS {
+		code.Import("embed")
+	} else {
+		code.Import(blankImport + "embed")
+	}
+	// Keep the patterns for FinishFile
+	code.embs = append(code.embs, embedSpec{patterns: a.Patterns, file: a.Type != EmbedFS})
+	// Add the directive and the variable declaration
+	code.Embed(a.Patterns...)
+	code.attach()
+	code.add("EmbedVar", "var ", a.Ident, " ", embedTypes[a.Type], "\n")
+	// Return code
+	return code
+}
+
+// embedded returns an error, if the patterns of a variable generated by EmbedVar do not match files in directory dn of fsys.
+func (code *Code) embedded(fsys FS, dn tsfio.Directory) error {
+	for _, s := range code.embs {
+		// Count the files matching the patterns
+		n := 0
+		for _, p := range s.patterns {
+			m, e := embedFiles(fsys, dn, p, s.file)
+			if e != nil {
+				return tserr.Op(&tserr.OpArgs{Op: "embed", Fn: p, Err: e})
+			}
+			// Return an error, if the pattern does not match a file
+			if m == 0 {
+				return tserr.NotExistent("file matching embed pattern " + p + " in " + string(dn))
+			}
+			n += m
+		}
+		// Return an error, if a string or byte slice does not match exactly one file
+		if s.file && n != 1 {
+			return tserr.Equal(&tserr.EqualArgs{Var: "number of files matching embed patterns " + strings.Join(s.patterns, " "), Actual: int64(n), Want: 1})
+		}
+	}
+	return nil
+}
+
+// embedFiles returns the number of files in directory dn of fsys matching embed pattern p. Files in matching directories
+// are counted recursively, except files and directories starting with . or _, unless p has the prefix all:. If file is true,
+// it returns an error, if p matches a directory.
+func embedFiles(fsys FS, dn tsfio.Directory, p string, file bool) (int, error) {
+	q, all := strings.CutPrefix(p, "all:")
+	// Retrieve the files and directories matching the elements of the pattern one by one
+	var fns []tsfio.Filename
+	dns := []tsfio.Directory{dn}
+	els := strings.Split(q, "/")
+	for i, el := range els {
+		var next []tsfio.Directory
+		for _, d := range dns {
+			fs, ds, e := listDir(fsys, d)
+			if e != nil {
+				return 0, e
+			}
+			// Keep the matching files of the last element and the matching directories
+			if i == len(els)-1 {
+				for _, f := range fs {
+					if ok, _ := path.Match(el, filepath.Base(string(f))); ok {
+						fns = append(fns, f)
+					}
+				}
+			}
+			for _, s := range ds {
+				if ok, _ := path.Match(el, filepath.Base(string(s))); ok {
+					next = append(next, s)
+				}
+			}
+		}
+		dns = next
+	}
+	// Return an error, if a directory matches and a file is required
+	if file && len(dns) > 0 {
+		return 0, tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: string(dns[0]), Want: "file"})
+	}
+	// Count the matching files and the files in the matching directories
+	n := len(fns)
+	for len(dns) > 0 {
+		d := dns[0]
+		dns = dns[1:]
+		fs, ds, e := listDir(fsys, d)
+		if e != nil {
+			return 0, e
+		}
+		// Skip hidden files and directories inside a matching directory
+		for _, f := range fs {
+			if all || !hidden(string(f)) {
+				n++
+			}
+		}
+		for _, s := range ds {
+			if all || !hidden(string(s)) {
+				dns = append(dns, s)
+			}
+		}
+	}
+	return n, nil
+}
+
+// listDir returns the regular files and the subdirectories in directory dn of fsys. They are empty, if dn does not exist.
+func listDir(fsys FS, dn tsfio.Directory) ([]tsfio.Filename, []tsfio.Directory, error) {
+	fns, e := fsys.ListFiles(dn)
+	if errors.Is(e, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if e != nil {
+		return nil, nil, e
+	}
+	dns, e := fsys.ListDirs(dn)
+	if e != nil {
+		return nil, nil, e
+	}
+	return fns, dns, nil
+}
+
+// hidden returns true, if the base name of path p starts with . or _.
+func hidden(p string) bool {
+	h := filepath.Base(p)[0]
+	return h == '.' || h == '_'
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"os"            // os
+	"path/filepath" // filepath
+	"strings"       // strings
+	"testing"       // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// newEmbedCodefile returns a new Codefile with the files query.sql, tmpl/a.tmpl and tmpl/_skip.tmpl in its directory.
+// The test fails if a file cannot be created.
+func newEmbedCodefile(t *testing.T) *lpcode.Codefile {
+	// Retrieve a new Codefile
+	cf := newCodefile(t)
+	d := filepath.Dir(string(cf.Filepath()))
+	// Create the files to embed
+	if e := os.Mkdir(filepath.Join(d, "tmpl"), 0755); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Mkdir", Fn: d, Err: e}))
+	}
+	for _, fn := range []string{"query.sql", "tmpl/a.tmpl", "tmpl/_skip.tmpl"} {
+		if e := os.WriteFile(filepath.Join(d, fn), []byte(testKey), 0644); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: fn, Err: e}))
+		}
+	}
+	// Return the Codefile
+	return cf
+}
+
+// TestEmbedVar tests EmbedVar to generate variables with embedded files and to register the embed import.
+// The test fails if generating the file fails or if the file does not contain the expected declarations.
+func TestEmbedVar(t *testing.T) {
+	// Generate a file with a string and an embed.FS variable
+	cf := newEmbedCodefile(t)
+	c := lpcode.NewCode().Doc(lpcode.NewDoc().Paragraph("query is the SQL query.")).
+		EmbedVar(&lpcode.EmbedVarArgs{Ident: "query", Type: lpcode.EmbedString, Patterns: []string{"query.sql"}}).
+		EmbedVar(&lpcode.EmbedVarArgs{Ident: "tmpl", Type: lpcode.EmbedFS, Patterns: []string{"tmpl/*.tmpl", "query.sql"}})
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the file does not contain the expected declarations
+	a := readFile(t, cf.Filepath())
+	for _, w := range []string{"import (\n\t\"embed\"\n)\n", "// query is the SQL query.\n//\n//go:embed query.sql\nvar query string\n",
+		"//go:embed tmpl/*.tmpl query.sql\nvar tmpl embed.FS\n"} {
+		if !strings.Contains(a, w) {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "embedded file", Actual: a, Want: w}))
+		}
+	}
+}
+
+// TestEmbedVarBlank tests EmbedVar to import embed for its side effects only, if no embed.FS is generated.
+// The test fails if generating the file fails or if the blank import is missing.
+func TestEmbedVarBlank(t *testing.T) {
+	// Generate a file with a byte slice variable
+	cf := newEmbedCodefile(t)
+	c := lpcode.NewCode().EmbedVar(&lpcode.EmbedVarArgs{Ident: "query", Type: lpcode.EmbedBytes, Patterns: []string{"query.sql"}})
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the blank import is missing
+	if a, w := readFile(t, cf.Filepath()), "import (\n\t_ \"embed\"\n)\n"; !strings.Contains(a, w) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "blank import", Actual: a, Want: w}))
+	}
+}
+
+// TestEmbedVarMemFS tests FinishFile to match the embed patterns in the filesystem of the Codefile. The test fails
+// if generating the file in a MemFS holding the files to embed fails or if a pattern matching only on disk is accepted.
+func TestEmbedVarMemFS(t *testing.T) {
+	// Retrieve a new Codefile in a MemFS containing the files to embed
+	m, d := lpcode.NewMemFS(nil), t.TempDir()
+	cf, e := lpcode.NewCodefileFS(m, tsfio.Directory(d), "embed.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewCodefileFS", Fn: d, Err: e}))
+	}
+	for _, fn := range []string{"query.sql", "tmpl/a.tmpl", "tmpl/_skip.tmpl"} {
+		if e := m.WriteFile(tsfio.Filename(filepath.Join(d, fn)), []byte(testKey)); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: fn, Err: e}))
+		}
+	}
+	// The test fails if generating the file fails
+	c := lpcode.NewCode().EmbedVar(&lpcode.EmbedVarArgs{Ident: "query", Type: lpcode.EmbedString, Patterns: []string{"query.sql"}}).
+		EmbedVar(&lpcode.EmbedVarArgs{Ident: "tmpl", Type: lpcode.EmbedFS, Patterns: []string{"tmpl"}})
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if a file existing only on disk is accepted
+	if e := os.WriteFile(filepath.Join(d, "disk.sql"), []byte(testKey), 0644); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: "disk.sql", Err: e}))
+	}
+	c = lpcode.NewCode().EmbedVar(&lpcode.EmbedVarArgs{Ident: "disk", Type: lpcode.EmbedString, Patterns: []string{"disk.sql"}})
+	if e := generate(cf, c); e == nil {
+		t.Error(tserr.NilFailed("disk.sql"))
+	}
+}
+
+// TestEmbedVarErr tests FinishFile to fail, if the embed patterns do not match files in the directory of the Codefile
+// or match more than one file or a directory for a string or byte slice. The test fails if FinishFile returns nil.
+func TestEmbedVarErr(t *testing.T) {
+	// Declare the invalid variables
+	tcs := map[string]*lpcode.EmbedVarArgs{
+		"missing":   {Ident: "x", Type: lpcode.EmbedFS, Patterns: []string{"missing/*.sql"}},
+		"partial":   {Ident: "x", Type: lpcode.EmbedFS, Patterns: []string{"tmpl/_*.tmpl", "missing.sql"}},
+		"directory": {Ident: "x", Type: lpcode.EmbedString, Patterns: []string{"tmpl"}},
+		"multiple":  {Ident: "x", Type: lpcode.EmbedBytes, Patterns: []string{"query.sql", "tmpl/*.tmpl"}},
+		"invalid":   {Ident: "x", Type: lpcode.EmbedFS, Patterns: []string{"../query.sql"}},
+		"type":      {Ident: "x", Type: lpcode.EmbedFS + 1, Patterns: []string{"query.sql"}},
+	}
+	for n, tc := range tcs {
+		// The test fails if FinishFile returns nil
+		if e := generate(newEmbedCodefile(t), lpcode.NewCode().EmbedVar(tc)); e == nil {
+			t.Error(tserr.NilFailed(n))
+		}
+	}
+}
+
+// TestEmbedVarNil tests EmbedVar to return nil in case *Code or the arguments are nil.
+// The test fails if EmbedVar does not return nil.
+func TestEmbedVarNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if EmbedVar does not return nil
+	if c.EmbedVar(&lpcode.EmbedVarArgs{}) != nil || lpcode.NewCode().EmbedVar(nil) != nil {
+		t.Error(tserr.NotNil("EmbedVar"))
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"bytes"      // bytes
+	"go/ast"     // ast
+	"go/format"  // format
+	"go/parser"  // parser
+	"go/scanner" // scanner
+	"go/token"   // token
+	"slices"     // slices
+	"strconv"    // strconv
+	"strings"    // strings
+)
+
+// Formatter formats source code. Format returns the formatted source code or an error,
+// if src cannot be formatted. Syntax errors should be returned as scanner.ErrorList, so that
+// Code and Codefile can point to the builder call which produced the offending source code.
+type Formatter interface {
+	Format(src []byte) ([]byte, error)
+}
+
+// Gofmt formats source code in canonical gofmt style using Source from the go/format package.
+// It is the default Formatter of Code and Codefile.
+type Gofmt struct{}
+
+// NoFormat returns the source code unchanged. It can be used to generate output other than Go source code.
+type NoFormat struct{}
+
+// Strict formats source code with Gofmt and applies a stricter rule set in the style of gofumpt:
+// empty lines at the beginning and the end of blocks are removed, line comments start with
+// a space unless they are directives, and std library imports are grouped before all other imports
+// as with SortImports.
+type Strict struct{}
+
+// SortImports formats source code with Gofmt after merging all import declarations into a single
+// import declaration preceded by the doc comments of all merged declarations and the comments between them.
+// Comments inside the declarations move with the following import spec. Duplicate imports
+// are removed, std library imports are grouped before all other imports and each group is sorted
+// by import path. Source code without package clause and source code importing "C" is formatted
+// with Gofmt only.
+type SortImports struct{}
+
+// Formatters applies the contained formatters in order. It returns the error of the first
+// failing Formatter.
+type Formatters []Formatter
+
+// Format formats src with Source from the go/format package.
+func (Gofmt) Format(src []byte) ([]byte, error) {
+	// Format the source code using Source from the go/format package
+	return format.Source(src)
+}
+
+// Format returns a copy of src.
+func (NoFormat) Format(src []byte) ([]byte, error) {
+	// Return a copy of the source code
+	return bytes.Clone(src), nil
+}
+
+// Format formats src with the formatters in f in order.
+func (f Formatters) Format(src []byte) ([]byte, error) {
+	// Apply each formatter
+	for _, fm := range f {
+		// Skip nil formatters
+		if fm == nil {
+			continue
+		}
+		// Format the source code
+		o, e := fm.Format(src)
+		// Return the error, in case the formatter fails
+		if e != nil {
+			return nil, e
+		}
+		src = o
+	}
+	// Return the formatted source code
+	return src, nil
+}
+
+// Format formats src with SortImports and the strict rule set.
+func (Strict) Format(src []byte) ([]byte, error) {
+	// Format the source code and sort the imports
+	o, e := SortImports{}.Format(src)
+	// Return the error, in case formatting fails
+	if e != nil {
+		return nil, e
+	}
+	// Retrieve the lines which are part of multi-line string literals or block comments
+	raw := rawLines(o)
+	// Split the formatted source code into lines
+	lines := strings.Split(string(o), "\n")
+	// Initialize the resulting lines
+	res := make([]string, 0, len(lines))
+	for i, l := range lines {
+		// Keep lines in string literals and block comments unchanged
+		if raw[i+1] {
+			res = append(res, l)
+			continue
+		}
+		t := strings.TrimSpace(l)
+		// Remove empty lines after a block opening and before a block ending
+		if t == "" && len(res) > 0 && i+1 < len(lines) {
+			p, n := strings.TrimSpace(res[len(res)-1]), strings.TrimSpace(lines[i+1])
+			if strings.HasSuffix(p, "{") || strings.HasPrefix(n, "}") {
+				continue
+			}
+		}
+		// Add a space to line comments without a space unless the comment is a directive
+		if strings.HasPrefix(t, "//") && len(t) > 2 && !strings.ContainsAny(t[2:3], " \t/") && !isDirective(t) {
+			l = l[:len(l)-len(t)] + "// " + t[2:]
+		}
+		res = append(res, l)
+	}
+	// Format the result with gofmt
+	return Gofmt{}.Format([]byte(strings.Join(res, "\n")))
+}
+
+// isDirective returns true, if line comment c is a directive, like //go:build, //nolint:all or //export.
+func isDirective(c string) bool {
+	// Retrieve the comment text
+	c = strings.TrimPrefix(c, "//")
+	// Return true for cgo and line directives
+	if strings.HasPrefix(c, "export ") || strings.HasPrefix(c, "extern ") || strings.HasPrefix(c, "line ") {
+		return true
+	}
+	// Return true for directives of the form //name:args
+	i := strings.Index(c, ":")
+	if i <= 0 {
+		return false
+	}
+	// The name must consist of lower case letters and digits only
+	for _, r := range c[:i] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// rawLines returns the line numbers in src, which are part of multi-line string
+// literals or block comments, without their first line. Their contents must not be changed
+// by line based rules.
+func rawLines(src []byte) map[int]bool {
+	// Initialize the result
+	r := make(map[int]bool)
+	// Initialize the scanner
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, scanner.ScanComments)
+	// Scan all tokens
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Mark all but the first line of multi-line tokens
+		if (tok == token.STRING || tok == token.COMMENT) && strings.Contains(lit, "\n") {
+			l := f.Line(pos)
+			for i := 1; i <= strings.Count(lit, "\n"); i++ {
+				r[l+i] = true
+			}
+		}
+	}
+	// Return the result
+	return r
+}
+
+// importSpec is the text of an import spec with its comments, retrieved by SortImports
+type importSpec struct {
+	key  string // import path followed by the import name for sorting and removing duplicates
+	std  bool   // true, if the import path belongs to the std library
+	text string // source code of the import spec including preceding and trailing comments
+}
+
+// Format merges and sorts the import declarations in src and formats the result with Gofmt.
+func (SortImports) Format(src []byte) ([]byte, error) {
+	// Format the source code with gofmt
+	o, e := Gofmt{}.Format(src)
+	// Return the error, in case formatting fails
+	if e != nil {
+		return nil, e
+	}
+	// Parse the formatted source code
+	fset := token.NewFileSet()
+	f, e := parser.ParseFile(fset, "", o, parser.ParseComments|parser.ImportsOnly)
+	// Return the formatted source code, if it is not a complete Go source file
+	if e != nil {
+		return o, nil
+	}
+	// Retrieve the import declarations
+	var decls []*ast.GenDecl
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); ok && g.Tok == token.IMPORT {
+			decls = append(decls, g)
+		}
+	}
+	// Return the formatted source code, if there are no imports or if "C" is imported
+	if len(decls) == 0 || slices.ContainsFunc(f.Imports, func(s *ast.ImportSpec) bool { return s.Path.Value == `"C"` }) {
+		return o, nil
+	}
+	// off returns the offset of position p
+	off := func(p token.Pos) int { return fset.Position(p).Offset }
+	// eol returns the offset of the end of the line containing offset i
+	eol := func(i int) int {
+		if n := bytes.IndexByte(o[i:], '\n'); n >= 0 {
+			return i + n
+		}
+		return len(o)
+	}
+	// text returns the source code between offsets i and j without surrounding white space and empty lines,
+	// except empty lines in block comments
+	text := func(i, j int) string {
+		if i >= j {
+			return ""
+		}
+		var ls []string
+		// open is the number of block comments opened before the current line, which are not closed
+		open := 0
+		for _, l := range strings.Split(string(o[i:j]), "\n") {
+			if strings.TrimSpace(l) != "" || open > 0 {
+				ls = append(ls, l)
+			}
+			open += strings.Count(l, "/*") - strings.Count(l, "*/")
+		}
+		return strings.TrimSpace(strings.Join(ls, "\n"))
+	}
+	// Retrieve the comments before, between and after the import specs and the text of each import spec
+	// with the comments preceding it in its declaration and its trailing comment
+	var head, tail []string
+	var specs []importSpec
+	// keep appends s to c, if it is not empty
+	keep := func(c []string, s string) []string {
+		if s != "" {
+			return append(c, s)
+		}
+		return c
+	}
+	for i, d := range decls {
+		// Keep the comments between the previous declaration and d including the doc comment of d
+		if i > 0 {
+			head = keep(head, text(eol(off(decls[i-1].End())), off(d.Pos())))
+		}
+		// Retrieve the start of the text of the first import spec
+		start := off(d.Pos()) + len("import")
+		if d.Lparen.IsValid() {
+			start = eol(off(d.Lparen))
+			head = keep(head, text(off(d.Lparen)+1, start))
+		}
+		for _, sp := range d.Specs {
+			s := sp.(*ast.ImportSpec)
+			end := eol(off(s.End()))
+			p, _ := strconv.Unquote(s.Path.Value)
+			n := ""
+			if s.Name != nil {
+				n = s.Name.Name
+			}
+			specs = append(specs, importSpec{key: p + " " + n, std: !strings.Contains(strings.Split(p, "/")[0], "."), text: text(start, end)})
+			start = end
+		}
+		// Keep the comments after the last import spec and after the closing parenthesis
+		if d.Rparen.IsValid() {
+			tail = keep(keep(tail, text(start, off(d.Rparen))), text(off(d.Rparen)+1, eol(off(d.Rparen))))
+		}
+	}
+	// Sort the import specs by import path and import name
+	slices.SortStableFunc(specs, func(a, b importSpec) int { return strings.Compare(a.key, b.key) })
+	// Group the import specs by std library and other imports and remove duplicates, keeping their comments
+	var std, other []string
+	for i, s := range specs {
+		g := &other
+		if s.std {
+			g = &std
+		}
+		if i > 0 && specs[i-1].key == s.key {
+			(*g)[len(*g)-1] = dupComments(specs[i-1].text, s.text) + (*g)[len(*g)-1]
+			continue
+		}
+		*g = append(*g, s.text)
+	}
+	// Build the merged import declaration, preceded by the comments between the merged declarations
+	var b strings.Builder
+	for _, h := range head {
+		b.WriteString(h + "\n")
+	}
+	b.WriteString("import (\n")
+	b.WriteString(strings.Join(std, "\n"))
+	if len(std) > 0 && len(other) > 0 {
+		b.WriteString("\n\n")
+	}
+	b.WriteString(strings.Join(other, "\n"))
+	for _, c := range tail {
+		b.WriteString("\n" + c)
+	}
+	b.WriteString("\n)")
+	// Replace the import declarations with the merged import declaration
+	start, end := off(decls[0].Pos()), eol(off(decls[len(decls)-1].End()))
+	r := append(append(bytes.Clone(o[:start]), b.String()...), o[end:]...)
+	// Format the result with gofmt
+	return Gofmt{}.Format(r)
+}
+
+// dupComments returns the comments of import spec text dup, which duplicates import spec text s, followed by a new line.
+// It returns an empty string, if dup has no comments.
+func dupComments(s, dup string) string {
+	// Retrieve the import spec line of s, which is the last line without its comments
+	l := s[strings.LastIndex(s, "\n")+1:]
+	if i := strings.Index(l, "//"); i >= 0 {
+		l = l[:i]
+	}
+	l = strings.TrimSpace(l)
+	// Return the comments of dup by removing the import spec
+	if c := strings.TrimSpace(strings.Replace(dup, l, "", 1)); c != "" {
+		return c + "\n"
+	}
+	return ""
+}
+
+// formatter returns f, if it is not nil, and Gofmt otherwise.
+func formatter(f Formatter) Formatter {
+	// Return Gofmt, if f is nil
+	if f == nil {
+		return Gofmt{}
+	}
+	// Return f
+	return f
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"errors"  // errors
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// testImports is a source file with multiple, unsorted import declarations
+const testImports = `package mirkwood
+
+import "github.com/thorstenrie/tserr" // tserr
+import (
+	"strings"
+	"fmt" // fmt
+)
+
+// Import tsfio
+import "github.com/thorstenrie/tsfio"
+import "strings"
+
+func brethil() {
+
+	//lothlorien
+	fmt.Println(strings.ToUpper(tsfio.Printable("fangorn")), tserr.NilPtr())
+
+	//go:noinline
+	_ = ` + "`ithilien\n\n//trollshaws`" + `
+
+}
+`
+
+// TestSortImports tests formatting source code with SortImports. The test fails if the
+// formatted source code does not match the contents of the golden file.
+func TestSortImports(t *testing.T) {
+	// Retrieve the source code formatted by SortImports
+	c := lpcode.NewCode().Ident(testImports).SetFormatter(lpcode.SortImports{})
+	// Evaluate the retrieved source code
+	if e := evalCode(c, "sortimports"); e != nil {
+		// The test fails if the formatted source code does not match the contents of the golden file
+		t.Error(e)
+	}
+}
+
+// TestStrict tests formatting source code with Strict. The test fails if the
+// formatted source code does not match the contents of the golden file.
+func TestStrict(t *testing.T) {
+	// Retrieve the source code formatted by Strict
+	c := lpcode.NewCode().Ident(testImports).SetFormatter(lpcode.Strict{})
+	// Evaluate the retrieved source code
+	if e := evalCode(c, "strict"); e != nil {
+		// The test fails if the formatted source code does not match the contents of the golden file
+		t.Error(e)
+	}
+}
+
+// testImportComments is a source file with comments before, inside, between and after import declarations
+const testImportComments = `package mirkwood
+
+import (
+	// Doc comment of fmt
+	f /* fmt */ "fmt"
+
+	// Floating comment before os
+
+	"os"
+	// Comment after the last import
+)
+
+// Comment between the import declarations
+import "strings" // strings
+import "bytes" // bytes
+import "os" // Duplicate of os
+
+var _, _, _, _ = f.Sprint, os.Exit, strings.ToUpper, bytes.NewReader
+`
+
+// TestSortImportsComments tests SortImports and Strict to keep all comments of the merged import declarations
+// and removed duplicates exactly once. The test fails if Format returns an error or the formatted source code differs from the expected source code.
+func TestSortImportsComments(t *testing.T) {
+	// Declare the expected source code
+	want := "package mirkwood\n\n// Comment between the import declarations\nimport (\n\t\"bytes\" // bytes\n\t// Doc comment of fmt\n" +
+		"\tf /* fmt */ \"fmt\"\n\t// Duplicate of os\n\t// Floating comment before os\n\t\"os\"\n\t\"strings\" // strings\n\t// Comment after the last import\n)\n\n" +
+		"var _, _, _, _ = f.Sprint, os.Exit, strings.ToUpper, bytes.NewReader\n"
+	for _, f := range []lpcode.Formatter{lpcode.SortImports{}, lpcode.Strict{}} {
+		// The test fails if Format returns an error
+		c := lpcode.NewCode().Ident(testImportComments).SetFormatter(f)
+		if e := c.Format(); e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "import comments", Err: e}))
+		}
+		// The test fails if the formatted source code differs from the expected source code
+		if a := c.String(); a != want {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "import comments", Actual: a, Want: want}))
+		}
+	}
+}
+
+// TestNoFormat tests formatting with NoFormat to keep the source code unchanged. The test fails
+// if Format returns an error or if the source code is changed.
+func TestNoFormat(t *testing.T) {
+	// Retrieve a new Code instance with text which is not valid Go source code
+	c := lpcode.NewCode().Ident(testComment).SetFormatter(lpcode.NoFormat{})
+	// The test fails if Format returns an error
+	if e := c.Format(); e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "code", Err: e}))
+	}
+	// The test fails if the text is changed
+	if c.String() != testComment {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "code", Actual: c.String(), Want: testComment}))
+	}
+}
+
+// shift is a Formatter, which prepends an empty line to the source code
+type shift struct{}
+
+// Format returns src preceded by an empty line.
+func (shift) Format(src []byte) ([]byte, error) {
+	// Return the source code preceded by an empty line
+	return append([]byte("\n"), src...), nil
+}
+
+// TestFormatters tests Formatters to return a FormatError of the failing Formatter. The builder call is only
+// retrieved, if the source code is unchanged by the formatters before the failing Formatter. The test fails if
+// Format does not return a FormatError or if the builder call is retrieved for changed source code.
+func TestFormatters(t *testing.T) {
+	// Declare the testcases with the expected builder call
+	tcs := []struct {
+		f  lpcode.Formatters
+		op string
+	}{
+		{lpcode.Formatters{lpcode.NoFormat{}, nil, lpcode.Gofmt{}}, "Call"},
+		{lpcode.Formatters{shift{}, lpcode.Gofmt{}}, ""},
+	}
+	for _, tc := range tcs {
+		// Retrieve a new Code instance with a syntax error formatted by the formatters
+		c := lpcode.NewCode().Call(testCall).SetFormatter(tc.f)
+		// The test fails if the error does not wrap a FormatError
+		var fe *lpcode.FormatError
+		if e := c.Format(); !errors.As(e, &fe) {
+			t.Fatal(tserr.NilFailed("Format"))
+		}
+		// The test fails if the builder call differs from the expected builder call
+		if fe.Op != tc.op {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Op", Actual: fe.Op, Want: tc.op}))
+		}
+	}
+}
+
+// TestSetFormatterNil tests SetFormatter to return nil in case
+// *Code is nil. The test fails if SetFormatter does not return nil.
+func TestSetFormatterNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if SetFormatter does not return nil.
+	if n := c.SetFormatter(lpcode.Gofmt{}); n != nil {
+		t.Error(tserr.NotNil("SetFormatter"))
+	}
+}
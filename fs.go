@@ -0,0 +1,374 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"bytes"         // bytes
+	"errors"        // errors
+	"io/fs"         // fs
+	"os"            // os
+	"path/filepath" // filepath
+	"slices"        // slices
+	"strings"       // strings
+	"sync"          // sync
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// tempPattern is the pattern of temporary files written by DiskFS
+const tempPattern = ".lpcode-*.tmp"
+
+// FS is the filesystem a Codefile writes to. DiskFS writes to disk and MemFS keeps files in memory.
+type FS interface {
+	// ReadFile returns the contents of file fn. The error wraps fs.ErrNotExist, if fn does not exist.
+	ReadFile(fn tsfio.Filename) ([]byte, error)
+	// WriteFile replaces file fn with b atomically. The file is either left untouched or holds b.
+	WriteFile(fn tsfio.Filename, b []byte) error
+	// RemoveFile removes file fn. It returns nil, if fn does not exist.
+	RemoveFile(fn tsfio.Filename) error
+	// ListFiles returns the sorted paths of the regular files in directory dn.
+	ListFiles(dn tsfio.Directory) ([]tsfio.Filename, error)
+	// ListDirs returns the sorted paths of the subdirectories in directory dn.
+	ListDirs(dn tsfio.Directory) ([]tsfio.Directory, error)
+}
+
+// DiskFS is the FS on disk. It is the default FS of a Codefile.
+type DiskFS struct{}
+
+// ReadFile returns the contents of file fn on disk.
+func (DiskFS) ReadFile(fn tsfio.Filename) ([]byte, error) {
+	// Return an error in case fn contains a blocked directory or filename
+	if e := tsfio.CheckFile(fn); e != nil {
+		return nil, tserr.Check(&tserr.CheckArgs{F: string(fn), Err: e})
+	}
+	// Read the file
+	return os.ReadFile(string(fn))
+}
+
+// WriteFile writes b to a temporary file in the directory of fn and renames it to fn. If fn exists,
+// its permission bits are kept. On failure, the temporary file is removed and fn is left untouched.
+func (DiskFS) WriteFile(fn tsfio.Filename, b []byte) error {
+	// Write the file atomically
+	return writeAtomic(fn, b)
+}
+
+// RemoveFile removes file fn from disk.
+func (DiskFS) RemoveFile(fn tsfio.Filename) error {
+	// Return an error in case fn contains a blocked directory or filename
+	if e := tsfio.CheckFile(fn); e != nil {
+		return tserr.Check(&tserr.CheckArgs{F: string(fn), Err: e})
+	}
+	// Remove the file, if it exists
+	if e := os.Remove(string(fn)); e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return tserr.Op(&tserr.OpArgs{Op: "Remove", Fn: string(fn), Err: e})
+	}
+	// Return nil
+	return nil
+}
+
+// ListFiles returns the sorted paths of the regular files in directory dn on disk.
+func (DiskFS) ListFiles(dn tsfio.Directory) ([]tsfio.Filename, error) {
+	// Return an error in case dn contains a blocked directory
+	if e := tsfio.CheckDir(dn); e != nil {
+		return nil, tserr.Check(&tserr.CheckArgs{F: string(dn), Err: e})
+	}
+	// Read the directory
+	des, e := os.ReadDir(string(dn))
+	if e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "ReadDir", Fn: string(dn), Err: e})
+	}
+	// Retrieve the regular files, which are sorted by ReadDir
+	var fns []tsfio.Filename
+	for _, de := range des {
+		if de.Type().IsRegular() {
+			fns = append(fns, tsfio.Filename(filepath.Join(string(dn), de.Name())))
+		}
+	}
+	// Return the files
+	return fns, nil
+}
+
+// ListDirs returns the sorted paths of the subdirectories in directory dn on disk.
+func (DiskFS) ListDirs(dn tsfio.Directory) ([]tsfio.Directory, error) {
+	// Return an error in case dn contains a blocked directory
+	if e := tsfio.CheckDir(dn); e != nil {
+		return nil, tserr.Check(&tserr.CheckArgs{F: string(dn), Err: e})
+	}
+	// Read the directory
+	des, e := os.ReadDir(string(dn))
+	if e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "ReadDir", Fn: string(dn), Err: e})
+	}
+	// Retrieve the subdirectories, which are sorted by ReadDir
+	var dns []tsfio.Directory
+	for _, de := range des {
+		if de.IsDir() {
+			dns = append(dns, tsfio.Directory(filepath.Join(string(dn), de.Name())))
+		}
+	}
+	// Return the subdirectories
+	return dns, nil
+}
+
+// MemFS is an in-memory FS. Written and removed files are kept in memory and can be inspected with ReadFile and Files.
+// Files which are not changed in memory are read from an underlying FS. Commit applies all changes to the underlying FS
+// in one step. MemFS is safe for concurrent use.
+type MemFS struct {
+	mu      sync.Mutex                // protects files
+	files   map[tsfio.Filename][]byte // changed files, nil contents mark removed files
+	base    FS                        // underlying FS
+	basenil bool                      // true, if no underlying FS is provided
+}
+
+// NewMemFS returns a new, empty MemFS on top of base. If base is nil, files which are not
+// written to MemFS do not exist and Commit writes to DiskFS.
+func NewMemFS(base FS) *MemFS {
+	// Return the new MemFS with DiskFS as underlying FS, if base is nil
+	if base == nil {
+		return &MemFS{files: make(map[tsfio.Filename][]byte), base: DiskFS{}, basenil: true}
+	}
+	// Return the new MemFS
+	return &MemFS{files: make(map[tsfio.Filename][]byte), base: base}
+}
+
+// ReadFile returns the contents of file fn in memory or, if fn is not changed in memory, of the underlying FS.
+func (m *MemFS) ReadFile(fn tsfio.Filename) ([]byte, error) {
+	// Return an error in case m is nil
+	if m == nil {
+		return nil, tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Return the contents of fn, if it is changed in memory
+	fn = tsfio.Filename(filepath.Clean(string(fn)))
+	if b, ok := m.files[fn]; ok {
+		if b == nil {
+			return nil, &fs.PathError{Op: "read", Path: string(fn), Err: fs.ErrNotExist}
+		}
+		return bytes.Clone(b), nil
+	}
+	// Return an error, if no underlying FS is provided
+	if m.basenil {
+		return nil, &fs.PathError{Op: "read", Path: string(fn), Err: fs.ErrNotExist}
+	}
+	// Read fn from the underlying FS
+	return m.base.ReadFile(fn)
+}
+
+// WriteFile writes a copy of b to file fn in memory.
+func (m *MemFS) WriteFile(fn tsfio.Filename, b []byte) error {
+	// Return an error in case m is nil
+	if m == nil {
+		return tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Store a copy of b, which is never nil
+	m.files[tsfio.Filename(filepath.Clean(string(fn)))] = append([]byte{}, b...)
+	// Return nil
+	return nil
+}
+
+// RemoveFile marks file fn as removed in memory.
+func (m *MemFS) RemoveFile(fn tsfio.Filename) error {
+	// Return an error in case m is nil
+	if m == nil {
+		return tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Mark fn as removed
+	m.files[tsfio.Filename(filepath.Clean(string(fn)))] = nil
+	// Return nil
+	return nil
+}
+
+// Files returns the sorted names of all files written to memory and not removed.
+func (m *MemFS) Files() []tsfio.Filename {
+	// Return nil in case m is nil
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Retrieve the written files
+	var fns []tsfio.Filename
+	for fn, b := range m.files {
+		if b != nil {
+			fns = append(fns, fn)
+		}
+	}
+	// Sort and return the files
+	slices.Sort(fns)
+	return fns
+}
+
+// ListFiles returns the sorted paths of the regular files in directory dn in memory and, unless
+// changed in memory, in the underlying FS.
+func (m *MemFS) ListFiles(dn tsfio.Directory) ([]tsfio.Filename, error) {
+	// Return an error in case m is nil
+	if m == nil {
+		return nil, tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Retrieve the files of the underlying FS
+	var fns []tsfio.Filename
+	if !m.basenil {
+		f, e := m.base.ListFiles(dn)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			return nil, e
+		}
+		for _, fn := range f {
+			fn = tsfio.Filename(filepath.Clean(string(fn)))
+			if _, ok := m.files[fn]; !ok {
+				fns = append(fns, fn)
+			}
+		}
+	}
+	// Retrieve the files in memory, which are not removed
+	d := filepath.Clean(string(dn))
+	for fn, b := range m.files {
+		if b != nil && filepath.Dir(string(fn)) == d {
+			fns = append(fns, fn)
+		}
+	}
+	// Sort and return the files
+	slices.Sort(fns)
+	return fns, nil
+}
+
+// ListDirs returns the sorted paths of the subdirectories in directory dn, which contain files in memory
+// or exist in the underlying FS.
+func (m *MemFS) ListDirs(dn tsfio.Directory) ([]tsfio.Directory, error) {
+	// Return an error in case m is nil
+	if m == nil {
+		return nil, tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Retrieve the subdirectories of the underlying FS
+	var dns []tsfio.Directory
+	if !m.basenil {
+		ds, e := m.base.ListDirs(dn)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			return nil, e
+		}
+		for _, s := range ds {
+			dns = append(dns, tsfio.Directory(filepath.Clean(string(s))))
+		}
+	}
+	// Retrieve the subdirectories containing files in memory, which are not removed
+	d := filepath.Clean(string(dn))
+	for fn, b := range m.files {
+		r, e := filepath.Rel(d, filepath.Dir(string(fn)))
+		if b == nil || e != nil || r == "." || strings.HasPrefix(r, "..") {
+			continue
+		}
+		if s := tsfio.Directory(filepath.Join(d, strings.Split(filepath.ToSlash(r), "/")[0])); !slices.Contains(dns, s) {
+			dns = append(dns, s)
+		}
+	}
+	// Sort and return the subdirectories
+	slices.Sort(dns)
+	return dns, nil
+}
+
+// Commit applies all written and removed files to the underlying FS in one step and clears the memory.
+// Each file is replaced atomically. If a file cannot be written or removed, all files already changed
+// by Commit are restored and the changes are kept in memory.
+func (m *MemFS) Commit() error {
+	// Return an error in case m is nil
+	if m == nil {
+		return tserr.NilPtr()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Retrieve the changed files in sorted order
+	fns := make([]tsfio.Filename, 0, len(m.files))
+	for fn := range m.files {
+		fns = append(fns, fn)
+	}
+	slices.Sort(fns)
+	// prev holds the previous contents of the changed files, nil if they did not exist
+	prev := make(map[tsfio.Filename][]byte)
+	// restore restores the previous contents of the changed files
+	restore := func() {
+		for fn, b := range prev {
+			if b == nil {
+				m.base.RemoveFile(fn)
+			} else {
+				m.base.WriteFile(fn, b)
+			}
+		}
+	}
+	// Apply the changes
+	for _, fn := range fns {
+		// Retrieve the previous contents
+		old, e := m.base.ReadFile(fn)
+		if e != nil && !errors.Is(e, fs.ErrNotExist) {
+			restore()
+			return tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fn), Err: e})
+		}
+		// Write or remove the file
+		b := m.files[fn]
+		if b == nil {
+			e = m.base.RemoveFile(fn)
+		} else {
+			e = m.base.WriteFile(fn, b)
+		}
+		prev[fn] = old
+		// Restore all changed files, in case of an error
+		if e != nil {
+			restore()
+			return tserr.Op(&tserr.OpArgs{Op: "commit", Fn: string(fn), Err: e})
+		}
+	}
+	// Clear the memory
+	clear(m.files)
+	// Return nil
+	return nil
+}
+
+// writeAtomic writes b to a temporary file in the directory of fn and renames it to fn. If fn exists,
+// its permission bits are kept. On failure, the temporary file is removed and fn is left untouched.
+func writeAtomic(fn tsfio.Filename, b []byte) error {
+	// Return an error in case fn contains a blocked directory or filename
+	if e := tsfio.CheckFile(fn); e != nil {
+		return tserr.Check(&tserr.CheckArgs{F: string(fn), Err: e})
+	}
+	// Keep the permission bits of an existing file
+	perm := os.FileMode(0644)
+	if fi, e := os.Stat(string(fn)); e == nil {
+		perm = fi.Mode().Perm()
+	}
+	// Create the temporary file in the directory of fn
+	t, e := os.CreateTemp(filepath.Dir(string(fn)), tempPattern)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "CreateTemp", Fn: filepath.Dir(string(fn)), Err: e})
+	}
+	// Write, sync, close and rename the temporary file
+	_, e = t.Write(b)
+	if e == nil {
+		e = t.Sync()
+	}
+	if ec := t.Close(); e == nil {
+		e = ec
+	}
+	if e == nil {
+		e = os.Chmod(t.Name(), perm)
+	}
+	if e == nil {
+		e = os.Rename(t.Name(), string(fn))
+	}
+	// Remove the temporary file, in case of an error
+	if e != nil {
+		os.Remove(t.Name())
+		return tserr.Op(&tserr.OpArgs{Op: "write temporary file", Fn: t.Name(), Err: e})
+	}
+	// Return nil
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"errors"        // errors
+	"io/fs"         // fs
+	"os"            // os
+	"path/filepath" // filepath
+	"strings"       // strings
+	"testing"       // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// TestMemFS tests generating a Codefile in a MemFS and committing it to disk. The test fails if the file
+// is written to disk before Commit, if the file in memory does not match the golden file or if Commit does
+// not write the file to disk.
+func TestMemFS(t *testing.T) {
+	// Retrieve a new Codefile in a MemFS on top of the disk, so that the header and footer files are read from testdata
+	m, d := lpcode.NewMemFS(lpcode.DiskFS{}), t.TempDir()
+	cf, e := lpcode.NewCodefileFS(m, tsfio.Directory(d), testCodefile)
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewCodefileFS", Fn: d, Err: e}))
+	}
+	// Generate the file with a type declaration
+	c := lpcode.NewCode().TypeStruct(testStruct).VarSpec(&lpcode.VarSpecArgs{Ident: testIdent, Type: testType}).BlockEnd()
+	if e := generate(cf, c); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the file exists on disk
+	if _, e := os.Stat(string(cf.Filepath())); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if MemFS does not contain exactly the file
+	if f := m.Files(); len(f) != 1 || f[0] != tsfio.Filename(filepath.Clean(string(cf.Filepath()))) {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "files", Actual: int64(len(f)), Want: 1}))
+	}
+	// The test fails if the file in memory does not match the contents of the golden file
+	b, e := m.ReadFile(cf.Filepath())
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := tsfio.EvalGoldenFile(&tsfio.Testcase{Name: "codefile", Data: string(b)}); e != nil {
+		t.Error(e)
+	}
+	// Create the directory of the file and commit the MemFS to disk
+	if e := os.Mkdir(filepath.Join(d, "testdata"), 0755); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Mkdir", Fn: d, Err: e}))
+	}
+	if e := m.Commit(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Commit", Fn: d, Err: e}))
+	}
+	// The test fails if the file on disk does not match the file in memory or if MemFS is not empty
+	if f := readFile(t, cf.Filepath()); f != string(b) || len(m.Files()) != 0 {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: f, Want: string(b)}))
+	}
+}
+
+// TestMemFSCommitErr tests Commit to restore already committed files, if a file cannot be written.
+// The test fails if Commit returns nil or if an already committed file is not restored.
+func TestMemFSCommitErr(t *testing.T) {
+	// Create an existing file
+	d := t.TempDir()
+	fa, fb := tsfio.Filename(filepath.Join(d, "a.go")), tsfio.Filename(filepath.Join(d, "missing", "b.go"))
+	if e := tsfio.WriteSingleStr(fa, testComment); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteSingleStr", Fn: string(fa), Err: e}))
+	}
+	// Write the existing file and a file in a missing directory to a MemFS on disk
+	m := lpcode.NewMemFS(lpcode.DiskFS{})
+	if e := errors.Join(m.WriteFile(fa, []byte(testIdent)), m.WriteFile(fb, []byte(testIdent))); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if Commit returns nil
+	if e := m.Commit(); e == nil {
+		t.Error(tserr.NilFailed("Commit"))
+	}
+	// The test fails if the existing file is not restored
+	if f := readFile(t, fa); f != testComment {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(fa), Actual: f, Want: testComment}))
+	}
+}
+
+// TestMemFSRemove tests RemoveFile to hide a file of the underlying FS until Commit removes it.
+// The test fails if the removed file can be read or if it exists after Commit.
+func TestMemFSRemove(t *testing.T) {
+	// Create an existing file
+	fn := tsfio.Filename(filepath.Join(t.TempDir(), "a.go"))
+	if e := tsfio.WriteSingleStr(fn, testComment); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteSingleStr", Fn: string(fn), Err: e}))
+	}
+	// Remove the file in a MemFS on disk
+	m := lpcode.NewMemFS(lpcode.DiskFS{})
+	if e := m.RemoveFile(fn); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "RemoveFile", Fn: string(fn), Err: e}))
+	}
+	// The test fails if the removed file can be read
+	if _, e := m.ReadFile(fn); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.NilFailed("ReadFile"))
+	}
+	// The test fails if the file exists after Commit
+	if e := m.Commit(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Commit", Fn: string(fn), Err: e}))
+	}
+	if _, e := os.Stat(string(fn)); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: string(fn), Err: e}))
+	}
+}
+
+// TestMemFSNil tests the methods of MemFS to return an error in case
+// *MemFS is nil. The test fails if any method does not return an error.
+func TestMemFSNil(t *testing.T) {
+	// Declare m as type *MemFS and assign nil
+	var m *lpcode.MemFS = nil
+	// The test fails if any method does not return an error
+	if _, e := m.ReadFile(testCodefile); e == nil {
+		t.Error(tserr.NilFailed("ReadFile"))
+	}
+	if e := m.WriteFile(testCodefile, nil); e == nil {
+		t.Error(tserr.NilFailed("WriteFile"))
+	}
+	if e := m.RemoveFile(testCodefile); e == nil {
+		t.Error(tserr.NilFailed("RemoveFile"))
+	}
+	if e := m.Commit(); e == nil {
+		t.Error(tserr.NilFailed("Commit"))
+	}
+}
+
+// TestMemFSHeader tests StartFile to read the header file from the filesystem of the Codefile and to keep it unchanged
+// without template data. The test fails if generating the file fails or if the file does not start with the header.
+func TestMemFSHeader(t *testing.T) {
+	// Retrieve a new Codefile in a MemFS containing a header file with template actions
+	m, d := lpcode.NewMemFS(nil), t.TempDir()
+	cf, e := lpcode.NewCodefileFS(m, tsfio.Directory(d), "header.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewCodefileFS", Fn: d, Err: e}))
+	}
+	h := "// Render with {{.Package}}.\npackage " + testKey + "\n"
+	if e := m.WriteFile("header.go.header", []byte(h)); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: "header.go.header", Err: e}))
+	}
+	// The test fails if generating the file fails
+	if e := generate(cf, lpcode.NewCode()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the file does not contain the unchanged header
+	b, e := m.ReadFile(cf.Filepath())
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if !strings.HasSuffix(string(b), "\n\n"+h) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: string(cf.Filepath()), Actual: string(b), Want: h}))
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"bytes"      // bytes
+	"fmt"        // fmt
+	"go/scanner" // scanner
+	"go/token"   // token
+	"path"       // path
+	"slices"     // slices
+	"strconv"    // strconv
+	"strings"    // strings
+	"sync"       // sync
+)
+
+// Imports is a registry of imported packages. It assigns each import path a unique package
+// identifier, so that all files sharing the registry refer to a package by the same identifier.
+// Imports is safe for concurrent use.
+type Imports struct {
+	mu    sync.Mutex        // protects names and paths
+	names map[string]string // identifier of each import path
+	paths map[string]string // import path of each identifier
+}
+
+// blankImport is the prefix of import paths imported for their side effects only
+const blankImport = "_ "
+
+// NewImports returns a new, empty import registry.
+func NewImports() *Imports {
+	// Return the new registry
+	return &Imports{names: make(map[string]string), paths: make(map[string]string)}
+}
+
+// Add registers import path p and returns its identifier. The identifier is derived from the last element of p
+// without a major version suffix. If the identifier is already used by another import path, a number is appended.
+// It returns an empty string, if imp is nil.
+func (imp *Imports) Add(p string) string {
+	// Return an empty string in case imp is nil
+	if imp == nil {
+		return ""
+	}
+	imp.mu.Lock()
+	defer imp.mu.Unlock()
+	// Return the identifier, if p is already registered
+	if n, ok := imp.names[p]; ok {
+		return n
+	}
+	// Retrieve a unique identifier
+	b := importName(p)
+	n := b
+	for i := 2; imp.paths[n] != "" || token.IsKeyword(n); i++ {
+		n = fmt.Sprintf("%v%d", b, i)
+	}
+	// Register p and return the identifier
+	imp.names[p], imp.paths[n] = n, p
+	return n
+}
+
+// importName returns the default identifier for import path p: the last path element without a major
+// version suffix, with all characters which are not valid in identifiers removed.
+func importName(p string) string {
+	// Retrieve the last element, skip major version suffixes like v2
+	b := path.Base(p)
+	if len(b) > 1 && b[0] == 'v' && strings.Trim(b[1:], "0123456789") == "" {
+		b = path.Base(path.Dir(p))
+	}
+	// Remove the .vN suffix of gopkg.in paths and all invalid characters
+	b, _, _ = strings.Cut(b, ".")
+	b = strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, strings.TrimPrefix(b, "go-"))
+	// Prefix identifiers starting with a digit or empty identifiers
+	if b == "" || ('0' <= b[0] && b[0] <= '9') {
+		b = "pkg" + b
+	}
+	// Return the identifier
+	return b
+}
+
+// decl returns an import declaration for the import paths ps. Std library imports are grouped before all other
+// imports and each group is sorted. An import path is named explicitly, if its identifier differs from its last element.
+// An import path with prefix blankImport is imported for its side effects only, unless it is imported anyway.
+// It returns an empty string, if ps is empty.
+func (imp *Imports) decl(ps []string) string {
+	// Return an empty string, if ps is empty
+	if len(ps) == 0 {
+		return ""
+	}
+	// Group the import specs
+	var std, other []string
+	for _, p := range ps {
+		// Skip a blank import, if the import path is imported anyway
+		b, blank := strings.CutPrefix(p, blankImport)
+		if blank && slices.Contains(ps, b) {
+			continue
+		}
+		s := strconv.Quote(b)
+		if blank {
+			s = "_ " + s
+		} else if n := imp.Add(p); n != path.Base(p) {
+			s = n + " " + s
+		}
+		if strings.Contains(strings.Split(b, "/")[0], ".") {
+			other = append(other, s)
+		} else {
+			std = append(std, s)
+		}
+	}
+	// sortByPath sorts import specs by their import path
+	sortByPath := func(g []string) {
+		slices.SortFunc(g, func(a, b string) int { return strings.Compare(a[strings.Index(a, `"`):], b[strings.Index(b, `"`):]) })
+	}
+	sortByPath(std)
+	sortByPath(other)
+	// Return the import declaration
+	g := std
+	if len(std) > 0 && len(other) > 0 {
+		g = append(append(std, ""), other...)
+	} else if len(other) > 0 {
+		g = other
+	}
+	return "import (\n" + strings.Join(g, "\n") + "\n)\n\n"
+}
+
+// packageClauseEnd returns the offset after the line of the package clause in src. It returns zero,
+// if src does not contain a package clause.
+func packageClauseEnd(src []byte) int {
+	// Initialize the scanner
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, 0)
+	// Return zero, if the first token is not the package keyword followed by the package name
+	pos, tok, _ := s.Scan()
+	if tok != token.PACKAGE {
+		return 0
+	}
+	if _, tok, _ = s.Scan(); tok != token.IDENT {
+		return 0
+	}
+	// Return the offset after the line of the package clause
+	off := f.Offset(pos)
+	if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+		return off + i + 1
+	}
+	return len(src)
+}
+
+// packageClauseStart returns the offset of the package clause in src including its doc comment, where a build constraint
+// is placed. It returns -1, if src does not contain a package clause.
+func packageClauseStart(src []byte) int {
+	// Initialize the scanner with comments
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, scanner.ScanComments)
+	// Retrieve the start and last line of the comment group preceding the package clause
+	start, last := -1, 0
+	for {
+		pos, tok, lit := s.Scan()
+		switch {
+		case tok == token.COMMENT && (start < 0 || f.Line(pos) > last+1):
+			start, last = f.Offset(pos), f.Line(pos)+strings.Count(lit, "\n")
+		case tok == token.COMMENT:
+			last = f.Line(pos) + strings.Count(lit, "\n")
+		case tok == token.PACKAGE:
+			// Return the offset of the doc comment, if it directly precedes the package clause
+			if start >= 0 && last+1 == f.Line(pos) {
+				return start
+			}
+			return f.Offset(pos)
+		default:
+			// Return -1, since src does not start with a package clause
+			return -1
+		}
+	}
+}
+
+// declStart returns the offset after the line of the package clause and the import declarations in src,
+// where the other declarations start. It returns zero, if src starts with neither a package clause nor an import declaration.
+func declStart(src []byte) int {
+	// Initialize the scanner
+	fset := token.NewFileSet()
+	f := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(f, src, nil, 0)
+	// lineEnd returns the offset after the line of pos
+	lineEnd := func(pos token.Pos) int {
+		off := f.Offset(pos)
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			return off + i + 1
+		}
+		return len(src)
+	}
+	// Skip the package clause
+	end := packageClauseEnd(src)
+	_, tok, _ := s.Scan()
+	if end > 0 {
+		s.Scan()
+		s.Scan()
+		_, tok, _ = s.Scan()
+	}
+	// Skip the import declarations
+	for tok == token.IMPORT {
+		var pos token.Pos
+		for d := 0; ; {
+			pos, tok, _ = s.Scan()
+			if tok == token.EOF {
+				return end
+			}
+			if tok == token.LPAREN {
+				d++
+			} else if tok == token.RPAREN {
+				d--
+			} else if tok == token.SEMICOLON && d == 0 {
+				break
+			}
+		}
+		end = lineEnd(pos)
+		_, tok, _ = s.Scan()
+	}
+	// Return the offset
+	return end
+}
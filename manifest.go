@@ -0,0 +1,100 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"crypto/sha256" // sha256
+	"encoding/hex"  // hex
+	"encoding/json" // json
+	"errors"        // errors
+	"io/fs"         // fs
+	"path/filepath" // filepath
+	"slices"        // slices
+	"strings"       // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// ManifestName is the name of the manifest file a Package maintains in its directory.
+const ManifestName = "lpcode.json"
+
+// hashPrefix is the prefix of the content hashes in a manifest
+const hashPrefix = "sha256:"
+
+// Manifest is the record of the files generated by a Package. It is stored as JSON in the file ManifestName
+// in the directory of the Package. A later run uses the manifest to remove orphaned files, to detect manual
+// edits by a hash mismatch and to skip files whose inputs did not change.
+type Manifest struct {
+	Generator string         `json:"generator"` // name of the generator
+	Files     []ManifestFile `json:"files"`     // generated files sorted by path
+}
+
+// ManifestFile is a generated file in a Manifest.
+type ManifestFile struct {
+	Path   string   `json:"path"`             // path of the file relative to the directory of the Package, slash separated
+	Hash   string   `json:"hash"`             // content hash of the generated file
+	Inputs []string `json:"inputs,omitempty"` // inputs of the generator for the file
+}
+
+// ReadManifest reads the manifest in directory dn of fsys. It returns an empty manifest, if the manifest
+// does not exist. It returns an error, if the manifest cannot be read or decoded.
+func ReadManifest(fsys FS, dn tsfio.Directory) (*Manifest, error) {
+	// Return an error in case fsys is nil
+	if fsys == nil {
+		return nil, tserr.NilPtr()
+	}
+	// Read the manifest, return an empty manifest if it does not exist
+	fn := tsfio.Filename(filepath.Join(string(dn), ManifestName))
+	b, e := fsys.ReadFile(fn)
+	if errors.Is(e, fs.ErrNotExist) {
+		return &Manifest{}, nil
+	}
+	if e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fn), Err: e})
+	}
+	// Decode the manifest
+	m := &Manifest{}
+	if e := json.Unmarshal(b, m); e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "decode manifest", Fn: string(fn), Err: e})
+	}
+	// Return the manifest
+	return m, nil
+}
+
+// File returns the file with path p relative to the directory of the Package. It returns nil,
+// if m is nil or if the manifest does not contain p.
+func (m *Manifest) File(p string) *ManifestFile {
+	// Return nil in case m is nil
+	if m == nil {
+		return nil
+	}
+	// Return the file, if available
+	if i := slices.IndexFunc(m.Files, func(f ManifestFile) bool { return f.Path == p }); i >= 0 {
+		return &m.Files[i]
+	}
+	// Return nil
+	return nil
+}
+
+// encode returns the manifest as indented JSON with a trailing new line and the files sorted by path.
+func (m *Manifest) encode() ([]byte, error) {
+	// Sort the files by path
+	slices.SortFunc(m.Files, func(a, b ManifestFile) int { return strings.Compare(a.Path, b.Path) })
+	// Encode the manifest
+	b, e := json.MarshalIndent(m, "", "\t")
+	if e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "encode manifest", Fn: ManifestName, Err: e})
+	}
+	// Return the manifest with a trailing new line
+	return append(b, '\n'), nil
+}
+
+// contentHash returns the content hash of b as stored in a manifest.
+func contentHash(b []byte) string {
+	// Return the hex encoded SHA-256 hash of b
+	h := sha256.Sum256(b)
+	return hashPrefix + hex.EncodeToString(h[:])
+}
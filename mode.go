@@ -0,0 +1,91 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library package fmt
+import (
+	"fmt" // fmt
+)
+
+// Mode defines how FinishFile of a Codefile writes the file.
+type Mode int
+
+// Modes of a Codefile
+const (
+	// ModeWrite always writes the file. It is the default Mode. FinishFile returns an error
+	// wrapping an EditedError, if the existing file does not match the checksum embedded in its
+	// header, unless SetForce is set. If formatting fails, the unformatted contents are written to
+	// the file with suffix .lpcode-failed for inspection, which is removed by the next successful
+	// FinishFile. If the Codefile belongs to a Package, the .lpcode-failed file is written to the
+	// filesystem of the Package immediately, since Write of the Package refuses to write a failed
+	// Codefile.
+	ModeWrite Mode = iota
+	// ModeWriteIfChanged writes the file only if the formatted contents differ byte-for-byte
+	// from the existing file, so that file timestamps remain stable. Edited files and formatting
+	// failures are handled as in ModeWrite.
+	ModeWriteIfChanged
+	// ModeCheck never writes the file. FinishFile returns a CheckError with a unified diff,
+	// if the formatted contents differ from the existing file, for example to verify in CI
+	// that generated files are up to date.
+	ModeCheck
+	// ModeDryRun never writes the file. FinishFile writes a unified diff between the existing
+	// file and the formatted contents to the writer set by SetDiffOutput, so that changes can be
+	// reviewed before they are written.
+	ModeDryRun
+	// modeCount is the number of modes
+	modeCount
+)
+
+// CheckError is returned wrapped by FinishFile in ModeCheck, if the generated contents differ
+// from the existing file.
+type CheckError struct {
+	File string // path of the file
+	Diff string // unified diff between the existing file and the generated contents
+}
+
+// Error returns the error message including the unified diff.
+func (e *CheckError) Error() string {
+	// Return an empty string if e is nil
+	if e == nil {
+		return ""
+	}
+	// Return the error message
+	return fmt.Sprintf("%v is not up to date:\n%v", e.File, e.Diff)
+}
+
+// Status reports the result of FinishFile of a Codefile.
+type Status int
+
+// States reported by FinishFile
+const (
+	// StatusNone is reported if FinishFile did not succeed yet.
+	StatusNone Status = iota
+	// StatusCreated is reported if the file did not exist and was created. In ModeDryRun,
+	// it is reported if the file would be created.
+	StatusCreated
+	// StatusUpdated is reported if the existing file was written. In ModeDryRun,
+	// it is reported if the file would be changed.
+	StatusUpdated
+	// StatusUnchanged is reported if the existing file matches the contents and was not written.
+	// In ModeCheck and ModeDryRun, it is reported if the existing file is up to date.
+	StatusUnchanged
+)
+
+// statusNames contains the names of the states
+var statusNames = map[Status]string{
+	StatusNone:      "none",
+	StatusCreated:   "created",
+	StatusUpdated:   "updated",
+	StatusUnchanged: "unchanged",
+}
+
+// String returns the name of status s.
+func (s Status) String() string {
+	// Return the name of s, if it is known
+	if n, ok := statusNames[s]; ok {
+		return n
+	}
+	// Return unknown otherwise
+	return "unknown"
+}
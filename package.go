@@ -0,0 +1,383 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"bufio"         // bufio
+	"bytes"         // bytes
+	"errors"        // errors
+	"go/token"      // token
+	"io/fs"         // fs
+	"path/filepath" // filepath
+	"regexp"        // regexp
+	"slices"        // slices
+	"strings"       // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// DefaultHeader is the header template of the Codefiles of a Package. It marks the files as generated
+// following the Go convention, so that Package can identify its previously generated files.
+const DefaultHeader = "// Code generated by {{.Generator}}. DO NOT EDIT.\n\npackage {{.Package}}\n"
+
+// generated matches the comment marking a file as generated following the Go convention.
+var generated = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// PackageArgs contains the configuration of a Package created with NewPackage.
+type PackageArgs struct {
+	Dir       tsfio.Directory // directory of the package
+	Name      string          // name of the package
+	Generator string          // name of the generator, used to identify previously generated files
+	FS        FS              // filesystem the package is written to, DiskFS if nil
+	Force     bool            // overwrite files edited manually after they were generated
+}
+
+// Package generates the Codefiles of a Go package in one directory. The Codefiles share the package name
+// and an import registry. The Codefiles are finished into memory and Write writes all of them together.
+// Write also removes files previously generated by the same generator, which are no longer generated.
+// Package maintains a Manifest of the generated files in its directory.
+type Package struct {
+	dn      tsfio.Directory             // directory of the package
+	name    string                      // name of the package
+	gen     string                      // name of the generator
+	frc     bool                        // overwrite files edited manually
+	imp     *Imports                    // shared import registry
+	fsys    FS                          // filesystem the package is written to
+	mem     *MemFS                      // files finished but not yet written
+	man     *Manifest                   // manifest of the last Write
+	cfs     []*Codefile                 // Codefiles of the package
+	kept    []tsfio.Filename            // files kept unchanged by Skip
+	inputs  map[tsfio.Filename][]string // generator inputs of each file
+	removed []tsfio.Filename            // files removed by the last Write
+}
+
+// NewPackage returns a new Package configured by a. It reads the Manifest of a previous run, if any.
+// It returns an error, if a is nil, if the package name is not a valid identifier, if the generator name
+// is empty or if the manifest cannot be read.
+func NewPackage(a *PackageArgs) (*Package, error) {
+	// Return an error in case a is nil
+	if a == nil {
+		return nil, tserr.NilPtr()
+	}
+	// Return an error in case the package name is not a valid identifier
+	if !token.IsIdentifier(a.Name) {
+		return nil, tserr.Forbidden("package name " + a.Name)
+	}
+	// Return an error in case the generator name is empty
+	if a.Generator == "" {
+		return nil, tserr.Empty("generator")
+	}
+	// Return an error in case the directory is blocked
+	if e := tsfio.CheckDir(a.Dir); e != nil {
+		return nil, tserr.Check(&tserr.CheckArgs{F: string(a.Dir), Err: e})
+	}
+	// Retrieve the filesystem
+	fsys := a.FS
+	if fsys == nil {
+		fsys = DiskFS{}
+	}
+	// Read the manifest of a previous run
+	man, e := ReadManifest(fsys, a.Dir)
+	if e != nil {
+		return nil, e
+	}
+	// Return the new Package
+	return &Package{dn: a.Dir, name: a.Name, gen: a.Generator, frc: a.Force, imp: NewImports(), fsys: fsys, mem: NewMemFS(fsys),
+		man: man, inputs: make(map[tsfio.Filename][]string)}, nil
+}
+
+// Imports returns the import registry shared by all Codefiles of p. It returns nil, if p is nil.
+func (p *Package) Imports() *Imports {
+	// Return nil in case p is nil
+	if p == nil {
+		return nil
+	}
+	// Return the import registry
+	return p.imp
+}
+
+// Codefile returns a new Codefile for file fn in the directory of p. The Codefile uses the import
+// registry of p, DefaultHeader as header template and the package and generator name as template data.
+// The template data contains the inputs of fn provided to Skip, if any. FinishFile of the Codefile does
+// not write the file, it is written by Write of p. It returns an error, if p already contains fn.
+func (p *Package) Codefile(fn tsfio.Filename) (*Codefile, error) {
+	// Return an error in case p is nil
+	if p == nil {
+		return nil, tserr.NilPtr()
+	}
+	// Return an error in case p already contains fn
+	fp := p.path(fn)
+	if p.contains(fp) {
+		return nil, tserr.Duplicate(string(fn))
+	}
+	// Create the Codefile in memory
+	cf, e := NewCodefileFS(p.mem, p.dn, fn)
+	if e != nil {
+		return nil, tserr.Op(&tserr.OpArgs{Op: "NewCodefileFS", Fn: string(fn), Err: e})
+	}
+	// Configure the Codefile
+	cf.imp, cf.frc, cf.ffs = p.imp, p.frc, p.fsys
+	if e := cf.SetHeader(DefaultHeader); e != nil {
+		return nil, e
+	}
+	if e := cf.SetData(&TemplateData{Package: p.name, Generator: p.gen, Inputs: p.inputs[fp]}); e != nil {
+		return nil, e
+	}
+	// Add the Codefile to p and return it
+	p.cfs = append(p.cfs, cf)
+	return cf, nil
+}
+
+// Skip reports whether the generation of file fn in the directory of p can be skipped. It records inputs as
+// the generator inputs of fn. Skip returns true, if the Manifest contains fn with the same inputs and the file
+// is unchanged since it was generated. In this case, p keeps fn and it must not be generated. Otherwise, fn must
+// be generated with Codefile. It returns an error, if p is nil, if p already contains fn or if fn cannot be read.
+func (p *Package) Skip(fn tsfio.Filename, inputs ...string) (bool, error) {
+	// Return an error in case p is nil
+	if p == nil {
+		return false, tserr.NilPtr()
+	}
+	// Return an error in case p already contains fn
+	fp := p.path(fn)
+	if p.contains(fp) {
+		return false, tserr.Duplicate(string(fn))
+	}
+	// Record the inputs of fn
+	p.inputs[fp] = slices.Clone(inputs)
+	// Return false, if the inputs differ from the manifest
+	f := p.man.File(p.rel(fp))
+	if f == nil || !slices.Equal(f.Inputs, inputs) {
+		return false, nil
+	}
+	// Return false, if the file does not exist or is edited
+	b, e := p.fsys.ReadFile(fp)
+	if errors.Is(e, fs.ErrNotExist) {
+		return false, nil
+	}
+	if e != nil {
+		return false, tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fp), Err: e})
+	}
+	if contentHash(b) != f.Hash {
+		return false, nil
+	}
+	// Keep the file
+	p.kept = append(p.kept, fp)
+	return true, nil
+}
+
+// Edited returns the files in the Manifest, which exist and whose contents do not match their content hash.
+// These files were edited manually after they were generated. It returns an error, if p is nil or if a file cannot be read.
+func (p *Package) Edited() ([]tsfio.Filename, error) {
+	// Return an error in case p is nil
+	if p == nil {
+		return nil, tserr.NilPtr()
+	}
+	var ed []tsfio.Filename
+	for _, f := range p.man.Files {
+		// Read the file, skip it if it does not exist
+		fp := p.path(tsfio.Filename(filepath.FromSlash(f.Path)))
+		b, e := p.fsys.ReadFile(fp)
+		if errors.Is(e, fs.ErrNotExist) {
+			continue
+		}
+		if e != nil {
+			return nil, tserr.Op(&tserr.OpArgs{Op: "ReadFile", Fn: string(fp), Err: e})
+		}
+		// Add the file, if its contents do not match its content hash
+		if contentHash(b) != f.Hash {
+			ed = append(ed, fp)
+		}
+	}
+	// Return the edited files
+	return ed, nil
+}
+
+// Manifest returns a copy of the Manifest of p. Before the first Write, it is the manifest of a previous run.
+// It returns nil, if p is nil.
+func (p *Package) Manifest() *Manifest {
+	// Return nil in case p is nil
+	if p == nil {
+		return nil
+	}
+	// Return a copy of the manifest
+	m := &Manifest{Generator: p.man.Generator, Files: slices.Clone(p.man.Files)}
+	for i := range m.Files {
+		m.Files[i].Inputs = slices.Clone(m.Files[i].Inputs)
+	}
+	return m
+}
+
+// Write writes all Codefiles of p together with the Manifest and removes files in the directory of p previously
+// generated by the same generator, which are neither Codefiles of p nor kept by Skip. Previously generated files
+// listed in the Manifest, which were edited manually, are not removed. Write is all-or-nothing: it returns an error
+// without changing any file, if a Codefile is not finished, and restores all files, if a file cannot be written or removed.
+// Write returns an error, if p is nil.
+func (p *Package) Write() error {
+	// Return an error in case p is nil
+	if p == nil {
+		return tserr.NilPtr()
+	}
+	// Return an error, if a Codefile is not finished
+	for _, cf := range p.cfs {
+		if cf.State() != StateFinished {
+			return tserr.NotSet("FinishFile of " + string(cf.fp))
+		}
+	}
+	// Retrieve the files previously generated by the generator, which are no longer generated
+	stale, ed, e := p.stale()
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "retrieve stale files", Fn: string(p.dn), Err: e})
+	}
+	// Retrieve the new manifest
+	man, e := p.manifest(ed)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "retrieve manifest", Fn: string(p.dn), Err: e})
+	}
+	b, e := man.encode()
+	if e != nil {
+		return e
+	}
+	// Remove the stale files and write the manifest
+	for _, fn := range stale {
+		if e := p.mem.RemoveFile(fn); e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "RemoveFile", Fn: string(fn), Err: e})
+		}
+	}
+	if e := p.mem.WriteFile(p.path(ManifestName), b); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: ManifestName, Err: e})
+	}
+	// Write all files
+	if e := p.mem.Commit(); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "Commit", Fn: string(p.dn), Err: e})
+	}
+	// Keep the removed files and the manifest
+	p.removed, p.man = stale, man
+	// Return nil
+	return nil
+}
+
+// Removed returns the files removed by the last Write.
+func (p *Package) Removed() []tsfio.Filename {
+	// Return nil in case p is nil
+	if p == nil {
+		return nil
+	}
+	// Return a copy of the removed files
+	return slices.Clone(p.removed)
+}
+
+// stale returns the files in the directory of p generated by the generator of p and the files in the manifest,
+// which are neither Codefiles of p nor kept by Skip. Files in the manifest, which were edited manually, are not
+// returned as stale, but as edited.
+func (p *Package) stale() ([]tsfio.Filename, []tsfio.Filename, error) {
+	// Retrieve the edited files
+	ed, e := p.Edited()
+	if e != nil {
+		return nil, nil, e
+	}
+	// Retrieve the files in the directory and in the manifest
+	fns, e := p.mem.ListFiles(p.dn)
+	if e != nil {
+		return nil, nil, e
+	}
+	for _, f := range p.man.Files {
+		fns = append(fns, p.path(tsfio.Filename(filepath.FromSlash(f.Path))))
+	}
+	slices.Sort(fns)
+	var stale, edited []tsfio.Filename
+	for _, fn := range slices.Compact(fns) {
+		// Skip the files of p and the edited files
+		if p.contains(fn) {
+			continue
+		}
+		if slices.Contains(ed, fn) {
+			edited = append(edited, fn)
+			continue
+		}
+		// Read the file, skip it if it does not exist
+		b, e := p.mem.ReadFile(fn)
+		if errors.Is(e, fs.ErrNotExist) {
+			continue
+		}
+		if e != nil {
+			return nil, nil, e
+		}
+		// Add the file, if it is in the manifest or generated by the generator
+		if p.man.File(p.rel(fn)) != nil || generatedBy(b, p.gen) {
+			stale = append(stale, fn)
+		}
+	}
+	// Return the stale and edited files
+	return stale, edited, nil
+}
+
+// manifest returns the manifest of the Codefiles, the files kept by Skip and the edited files ed of p.
+func (p *Package) manifest(ed []tsfio.Filename) (*Manifest, error) {
+	m := &Manifest{Generator: p.gen}
+	// Add the Codefiles with the hash of their new contents
+	for _, cf := range p.cfs {
+		fp := p.path(cf.fn)
+		b, e := p.mem.ReadFile(fp)
+		if e != nil {
+			return nil, e
+		}
+		m.Files = append(m.Files, ManifestFile{Path: p.rel(fp), Hash: contentHash(b), Inputs: p.inputs[fp]})
+	}
+	// Add the kept and edited files with their previous entries
+	for _, fp := range append(slices.Clone(p.kept), ed...) {
+		if f := p.man.File(p.rel(fp)); f != nil {
+			m.Files = append(m.Files, *f)
+		}
+	}
+	// Return the manifest
+	return m, nil
+}
+
+// path returns the cleaned path of file fn in the directory of p.
+func (p *Package) path(fn tsfio.Filename) tsfio.Filename {
+	// Return the cleaned path
+	return tsfio.Filename(filepath.Join(string(p.dn), string(fn)))
+}
+
+// rel returns the slash separated path of fp relative to the directory of p, as stored in the manifest.
+func (p *Package) rel(fp tsfio.Filename) string {
+	// Retrieve the relative path, use fp if it is not in the directory of p
+	r, e := filepath.Rel(filepath.Clean(string(p.dn)), string(fp))
+	if e != nil {
+		r = string(fp)
+	}
+	// Return the slash separated path
+	return filepath.ToSlash(r)
+}
+
+// contains returns true, if fp is the cleaned path of a Codefile of p, of a file kept by Skip or of the manifest.
+func (p *Package) contains(fp tsfio.Filename) bool {
+	// Return true for the manifest and the kept files
+	if fp == p.path(ManifestName) || slices.Contains(p.kept, fp) {
+		return true
+	}
+	// Return true for the Codefiles
+	return slices.ContainsFunc(p.cfs, func(cf *Codefile) bool { return p.path(cf.fn) == fp })
+}
+
+// generatedBy returns true, if the Go source code b is marked as generated by generator gen before its package clause.
+func generatedBy(b []byte, gen string) bool {
+	// Scan the lines before the package clause
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		// Return false, if the package clause is reached
+		if strings.HasPrefix(l, "package ") {
+			return false
+		}
+		// Return true, if the line marks the file as generated by gen
+		if generated.MatchString(l) && strings.HasPrefix(l, "// Code generated by "+gen+".") {
+			return true
+		}
+	}
+	// Return false
+	return false
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"errors"        // errors
+	"io/fs"         // fs
+	"os"            // os
+	"path/filepath" // filepath
+	"strings"       // strings
+	"testing"       // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// testGenerator is the name of the generator of the test Package
+const testGenerator = "lpcode"
+
+// newPackage returns a new Package named mirkwood in a temporary directory. The test fails,
+// if the Package cannot be created.
+func newPackage(t *testing.T) (*lpcode.Package, string) {
+	// Retrieve the Package in a temporary directory
+	d := t.TempDir()
+	p, e := lpcode.NewPackage(&lpcode.PackageArgs{Dir: tsfio.Directory(d), Name: "mirkwood", Generator: testGenerator})
+	// The test fails if NewPackage returns an error
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewPackage", Fn: d, Err: e}))
+	}
+	// Return the Package and its directory
+	return p, d
+}
+
+// generateFunc generates file fn of p with function n printing with package fmt.
+func generateFunc(p *lpcode.Package, fn tsfio.Filename, n string) error {
+	// Retrieve the Codefile
+	cf, e := p.Codefile(fn)
+	if e != nil {
+		return e
+	}
+	// Start the file
+	if e := cf.StartFile(); e != nil {
+		return e
+	}
+	// Write the function using the shared import registry
+	i, e := cf.Import("fmt")
+	if e != nil {
+		return e
+	}
+	if e := cf.WriteCode("func " + n + "() { " + i + ".Println() }\n"); e != nil {
+		return e
+	}
+	// Finish the file
+	return cf.FinishFile()
+}
+
+// TestPackage tests generating a Package with two files. The test fails if the files are written before Write,
+// if a file does not contain the header and the import, if the stale generated file is not removed or if the
+// hand-written file is removed.
+func TestPackage(t *testing.T) {
+	// Retrieve the Package
+	p, d := newPackage(t)
+	// Create a stale generated file and a hand-written file
+	stale, hand := filepath.Join(d, "stale.go"), filepath.Join(d, "hand.go")
+	if e := errors.Join(
+		os.WriteFile(stale, []byte("// Code generated by "+testGenerator+". DO NOT EDIT.\n\npackage mirkwood\n"), 0644),
+		os.WriteFile(hand, []byte("// Code generated by other. DO NOT EDIT.\n\npackage mirkwood\n"), 0644),
+	); e != nil {
+		t.Fatal(e)
+	}
+	// Generate the files
+	if e := errors.Join(generateFunc(p, "a.go", "A"), generateFunc(p, "b.go", "B")); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if a file is written before Write
+	if _, e := os.Stat(filepath.Join(d, "a.go")); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: "a.go", Err: e}))
+	}
+	// Write the Package
+	if e := p.Write(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Write", Fn: d, Err: e}))
+	}
+	// The test fails if a file does not contain the header and the import
+	for _, fn := range []string{"a.go", "b.go"} {
+		f := readFile(t, tsfio.Filename(filepath.Join(d, fn)))
+		if !strings.HasPrefix(f, "// Code generated by "+testGenerator+". DO NOT EDIT.\n// lpcode:checksum ") ||
+			!strings.Contains(f, "\n\npackage mirkwood\n\nimport (\n\t\"fmt\"\n)\n") {
+			t.Error(tserr.NotExistent("header and import in " + fn))
+		}
+	}
+	// The test fails if the stale file is not removed
+	if _, e := os.Stat(stale); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: stale, Err: e}))
+	}
+	if r := p.Removed(); len(r) != 1 || string(r[0]) != stale {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "removed files", Actual: int64(len(r)), Want: 1}))
+	}
+	// The test fails if the hand-written file is removed
+	if _, e := os.Stat(hand); e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: hand, Err: e}))
+	}
+}
+
+// TestPackageUnfinished tests Write to return an error without writing any file, if a Codefile is not finished.
+// The test fails if Write returns nil or if a file is written.
+func TestPackageUnfinished(t *testing.T) {
+	// Retrieve the Package
+	p, d := newPackage(t)
+	// Generate one file and start another file
+	if e := generateFunc(p, "a.go", "A"); e != nil {
+		t.Fatal(e)
+	}
+	cf, e := p.Codefile("b.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Codefile", Fn: "b.go", Err: e}))
+	}
+	if e := cf.StartFile(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "StartFile", Fn: "b.go", Err: e}))
+	}
+	// The test fails if Write returns nil
+	if e := p.Write(); e == nil {
+		t.Error(tserr.NilFailed("Write"))
+	}
+	// The test fails if a file is written
+	if fns, _ := (lpcode.DiskFS{}).ListFiles(tsfio.Directory(d)); len(fns) != 0 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "files", Actual: int64(len(fns)), Want: 0}))
+	}
+}
+
+// TestPackageFailed tests FinishFile of a Codefile of a Package to write the unformatted contents to the .lpcode-failed
+// file on disk, if formatting fails. The test fails if FinishFile returns nil or if the .lpcode-failed file is not on disk.
+func TestPackageFailed(t *testing.T) {
+	// Retrieve the Package and a Codefile
+	p, d := newPackage(t)
+	cf, e := p.Codefile("a.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Codefile", Fn: "a.go", Err: e}))
+	}
+	// The test fails if FinishFile returns nil
+	if e := generate(cf, lpcode.NewCode().Call(testCall)); e == nil {
+		t.Fatal(tserr.NilFailed("FinishFile"))
+	}
+	// The test fails if the .lpcode-failed file is not on disk
+	if fns, _ := (lpcode.DiskFS{}).ListFiles(tsfio.Directory(d)); len(fns) != 1 || filepath.Base(string(fns[0])) != "a.go.lpcode-failed" {
+		t.Error(tserr.NotExistent("a.go.lpcode-failed in " + d))
+	}
+}
+
+// TestPackageVerify tests SetVerify of a Codefile of a Package to type check the file together with the files
+// generated before, which are not yet written to disk. The test fails if generating a file fails.
+func TestPackageVerify(t *testing.T) {
+	// Retrieve the Package
+	p, _ := newPackage(t)
+	// Generate a file declaring a type and a file declaring a method of the type with type checking enabled
+	types, e := p.Codefile("types.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Codefile", Fn: "types.go", Err: e}))
+	}
+	if e := generate(types, lpcode.NewCode().Ident("type T int\n")); e != nil {
+		t.Fatal(e)
+	}
+	methods, e := p.Codefile("methods.go")
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Codefile", Fn: "methods.go", Err: e}))
+	}
+	// The test fails if type checking does not find the type declared in the file generated before
+	if e := errors.Join(methods.SetVerify(&lpcode.VerifyArgs{}),
+		generate(methods, lpcode.NewCode().Ident("func (T) String() string { return \"T\" }\n"))); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// TestPackageErr tests NewPackage and Codefile to return errors for invalid arguments. The test fails
+// if an invalid package name, an empty generator or a duplicate Codefile does not return an error.
+func TestPackageErr(t *testing.T) {
+	// The test fails if an invalid package name or an empty generator does not return an error
+	d := tsfio.Directory(t.TempDir())
+	if _, e := lpcode.NewPackage(&lpcode.PackageArgs{Dir: d, Name: "mirk-wood", Generator: testGenerator}); e == nil {
+		t.Error(tserr.NilFailed("NewPackage with invalid name"))
+	}
+	if _, e := lpcode.NewPackage(&lpcode.PackageArgs{Dir: d, Name: "mirkwood"}); e == nil {
+		t.Error(tserr.NilFailed("NewPackage with empty generator"))
+	}
+	// The test fails if a duplicate Codefile does not return an error
+	p, _ := newPackage(t)
+	if _, e := p.Codefile("a.go"); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Codefile", Fn: "a.go", Err: e}))
+	}
+	if _, e := p.Codefile("a.go"); e == nil {
+		t.Error(tserr.NilFailed("Codefile with duplicate file"))
+	}
+}
+
+// TestPackageNil tests the methods of a nil Package. The test fails if a method returning
+// an error returns nil or if Imports and Removed do not return nil.
+func TestPackageNil(t *testing.T) {
+	// Retrieve a nil Package
+	var p *lpcode.Package
+	// The test fails if NewPackage, Codefile or Write return nil
+	if _, e := lpcode.NewPackage(nil); e == nil {
+		t.Error(tserr.NilFailed("NewPackage"))
+	}
+	if _, e := p.Codefile("a.go"); e == nil {
+		t.Error(tserr.NilFailed("Codefile"))
+	}
+	if e := p.Write(); e == nil {
+		t.Error(tserr.NilFailed("Write"))
+	}
+	// The test fails if Imports or Removed do not return nil
+	if p.Imports() != nil || p.Removed() != nil {
+		t.Error(tserr.NotNil("Imports and Removed"))
+	}
+}
+
+// TestPackageManifest tests the Manifest of a Package across runs. The test fails if the manifest does not list the
+// generated files, if an unchanged file is not skipped, if an edited file is not detected or removed, if an orphaned
+// file is not removed or if a file with changed inputs is skipped.
+func TestPackageManifest(t *testing.T) {
+	// Retrieve the Package of the first run
+	p, d := newPackage(t)
+	// Generate three files, file a.go has an input
+	if s, e := p.Skip("a.go", "mirkwood.yaml"); s || e != nil {
+		t.Fatal(tserr.Return(&tserr.ReturnArgs{Op: "Skip", Actual: "true", Want: "false"}))
+	}
+	if e := errors.Join(generateFunc(p, "a.go", "A"), generateFunc(p, "b.go", "B"), generateFunc(p, "c.go", "C"), p.Write()); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the manifest does not list the generated files with their hashes and inputs
+	m, e := lpcode.ReadManifest(lpcode.DiskFS{}, tsfio.Directory(d))
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "ReadManifest", Fn: d, Err: e}))
+	}
+	if len(m.Files) != 3 || m.Generator != testGenerator {
+		t.Fatal(tserr.Equal(&tserr.EqualArgs{Var: "manifest files", Actual: int64(len(m.Files)), Want: 3}))
+	}
+	if f := m.File("a.go"); f == nil || len(f.Inputs) != 1 || !strings.HasPrefix(f.Hash, "sha256:") {
+		t.Error(tserr.NotExistent("a.go with hash and inputs in manifest"))
+	}
+	// Edit file c.go manually
+	c := filepath.Join(d, "c.go")
+	if e := os.WriteFile(c, []byte(readFile(t, tsfio.Filename(c))+"// edited\n"), 0644); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: c, Err: e}))
+	}
+	// Retrieve the Package of the second run in the same directory
+	p, e = lpcode.NewPackage(&lpcode.PackageArgs{Dir: tsfio.Directory(d), Name: "mirkwood", Generator: testGenerator})
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewPackage", Fn: d, Err: e}))
+	}
+	// The test fails if the edited file is not detected
+	if ed, e := p.Edited(); e != nil || len(ed) != 1 || string(ed[0]) != c {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "edited files", Actual: int64(len(ed)), Want: 1}))
+	}
+	// The test fails if the unchanged file a.go is not skipped
+	if s, e := p.Skip("a.go", "mirkwood.yaml"); !s || e != nil {
+		t.Error(tserr.Return(&tserr.ReturnArgs{Op: "Skip", Actual: "false", Want: "true"}))
+	}
+	// Write the Package without generating b.go
+	if e := p.Write(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Write", Fn: d, Err: e}))
+	}
+	// The test fails if the orphaned file b.go is not removed or if a.go or the edited file c.go are removed
+	if _, e := os.Stat(filepath.Join(d, "b.go")); !errors.Is(e, fs.ErrNotExist) {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: "b.go", Err: e}))
+	}
+	for _, fn := range []string{"a.go", "c.go"} {
+		if _, e := os.Stat(filepath.Join(d, fn)); e != nil {
+			t.Error(tserr.Op(&tserr.OpArgs{Op: "Stat", Fn: fn, Err: e}))
+		}
+	}
+	if m := p.Manifest(); len(m.Files) != 2 || m.File("b.go") != nil {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "manifest files", Actual: int64(len(m.Files)), Want: 2}))
+	}
+	// The test fails if a file with changed inputs is skipped
+	p, e = lpcode.NewPackage(&lpcode.PackageArgs{Dir: tsfio.Directory(d), Name: "mirkwood", Generator: testGenerator})
+	if e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewPackage", Fn: d, Err: e}))
+	}
+	if s, e := p.Skip("a.go", "rivendell.yaml"); s || e != nil {
+		t.Error(tserr.Return(&tserr.ReturnArgs{Op: "Skip", Actual: "true", Want: "false"}))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages and tserr
+import (
+	"slices"  // slices
+	"strings" // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+)
+
+// placeholder is a named spot in the source code filled by Fill.
+type placeholder struct {
+	name string // name of the placeholder
+	off  int    // offset of the placeholder in the source code
+	fill *Code  // source code filling the placeholder, nil if not filled
+}
+
+// Placeholder reserves a spot named name at the end of the source code in code, for example for a lookup
+// table which is only known after all data is processed. The spot is filled with Fill. String, WriteTo and Verify
+// emit nothing for an unfilled placeholder, Format returns an error. It returns nil, if code is nil.
+func (code *Code) Placeholder(name string) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Reserve the spot
+	code.phs = append(code.phs, placeholder{name: name, off: code.b.Len()})
+	// Return code
+	return code
+}
+
+// Fill fills all placeholders named name in code, in its declarations and in the source code filling other placeholders
+// with the source code of c. A filled placeholder is filled again, if Fill is called again. Imports and declarations in the
+// parts of c are added to the parts of code. The builder calls recorded in c are kept. Rollback restores the placeholders
+// filled after Mark. It returns an error, if code or c is nil or if code does not contain a placeholder named name.
+func (code *Code) Fill(name string, c *Code) error {
+	// Return an error in case code or c is nil
+	if code == nil || c == nil {
+		return tserr.NilPtr()
+	}
+	// Copy c without its parts
+	f := &Code{spans: slices.Clone(c.spans), phs: slices.Clone(c.phs)}
+	f.b.Write(c.b.Bytes())
+	// Fill the placeholders in code and in its declarations
+	found := fill(code.phs, name, f)
+	for s := range code.decls {
+		for _, d := range code.decls[s] {
+			found = fill(d.phs, name, f) || found
+		}
+	}
+	// Return an error, if code does not contain the placeholder
+	if !found {
+		return tserr.NotExistent("placeholder " + name)
+	}
+	// Add the imports and declarations of c
+	code.merge(c)
+	// Return nil
+	return nil
+}
+
+// fill fills all placeholders in phs and in the source code filling them named name with f and returns true,
+// if a placeholder named name is found.
+func fill(phs []placeholder, name string, f *Code) bool {
+	found := false
+	for i := range phs {
+		if phs[i].name == name {
+			phs[i].fill, found = f, true
+		} else if phs[i].fill != nil {
+			found = fill(phs[i].fill.phs, name, f) || found
+		}
+	}
+	return found
+}
+
+// fillPlaceholders inserts the source code filling the placeholders of code at their offsets and removes the
+// filled placeholders. Placeholders at the same offset are filled in the order they were reserved. Placeholders
+// contained in the filling source code are filled as well.
+func (code *Code) fillPlaceholders() {
+	for {
+		// Retrieve the first filled placeholder, return if all placeholders are unfilled
+		i := slices.IndexFunc(code.phs, func(p placeholder) bool { return p.fill != nil })
+		if i < 0 {
+			return
+		}
+		p := code.phs[i]
+		// Remove the placeholder and insert its filling source code
+		code.phs = slices.Delete(code.phs, i, i+1)
+		code.insertCode(p.off, p.fill)
+	}
+}
+
+// unfilled returns an error, if code contains unfilled placeholders.
+func (code *Code) unfilled() error {
+	// Return nil, if all placeholders are filled
+	if len(code.phs) == 0 {
+		return nil
+	}
+	// Retrieve the names of the unfilled placeholders
+	var ns []string
+	for _, p := range code.phs {
+		if !slices.Contains(ns, p.name) {
+			ns = append(ns, p.name)
+		}
+	}
+	// Return the error
+	return tserr.NotSet("placeholder " + strings.Join(ns, ", "))
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"errors"  // errors
+	"strings" // strings
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestPlaceholder tests filling placeholders after the surrounding source code is generated. The test fails
+// if the placeholders are not filled at their position, in order and with the imports of the filling source code.
+func TestPlaceholder(t *testing.T) {
+	// Reserve the placeholders and generate the surrounding source code
+	c := lpcode.NewCode().Ident("package " + testKey + "\n").Placeholder("table").Placeholder("helper").
+		Ident("func lookup(i int) string { return table[i] }\n")
+	// Fill the placeholders after all data is known, the helper contains a nested placeholder
+	e := errors.Join(
+		c.Fill("helper", lpcode.NewCode().Ident("func helper() { ").Placeholder("body").Ident("}\n").Import("fmt")),
+		c.Fill("table", lpcode.NewCode().Ident("var table = []string{\"a\", \"b\"}\n")),
+		c.Fill("body", lpcode.NewCode().Ident("fmt.Println()")),
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the placeholders are not filled at their position and in order
+	if e := c.Format(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "Format", Fn: "placeholder", Err: e}))
+	}
+	want := "package " + testKey + "\n\nimport (\n\t\"fmt\"\n)\n\nvar table = []string{\"a\", \"b\"}\n\nfunc helper()             { fmt.Println() }\nfunc lookup(i int) string { return table[i] }\n"
+	if a := c.String(); a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "placeholder", Actual: a, Want: want}))
+	}
+}
+
+// TestPlaceholderUnfilled tests Format and FinishFile to return an error for an unfilled placeholder and Fill
+// to return an error for an unknown placeholder. The test fails if they return nil.
+func TestPlaceholderUnfilled(t *testing.T) {
+	// Reserve a placeholder
+	c := lpcode.NewCode().Ident("package " + testKey + "\n").Placeholder("table")
+	// The test fails if Fill of an unknown placeholder returns nil
+	if e := c.Fill("missing", lpcode.NewCode()); e == nil {
+		t.Error(tserr.NilFailed("Fill"))
+	}
+	// The test fails if FinishFile or Format return nil or the error does not name the placeholder
+	cf := newCodefileNamed(t, "testdata/placeholder.go")
+	if e := generate(cf, c); e == nil {
+		t.Error(tserr.NilFailed("FinishFile"))
+	}
+	if e := c.Format(); e == nil || !strings.Contains(e.Error(), "table") {
+		t.Error(tserr.NilFailed("Format"))
+	}
+}
+
+// TestPlaceholderNil tests Placeholder and Fill of nil Code. The test fails if Placeholder does not return nil or Fill returns nil.
+func TestPlaceholderNil(t *testing.T) {
+	// Retrieve nil Code
+	var c *lpcode.Code
+	// The test fails if Placeholder does not return nil or Fill returns nil
+	if c.Placeholder(testKey) != nil || c.Fill(testKey, lpcode.NewCode()) == nil {
+		t.Error(tserr.NotNil("Code"))
+	}
+}
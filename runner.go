@@ -0,0 +1,107 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"context" // context
+	"errors"  // errors
+	"runtime" // runtime
+	"sync"    // sync
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// Job is a Codefile generated by Run. Run calls Generate of File with Generator.
+type Job struct {
+	File      *Codefile         // file to generate
+	Generator func(*Code) error // collects the source code of the file
+}
+
+// RunArgs contains the configuration of Run.
+type RunArgs struct {
+	Workers int // maximum number of files generated in parallel, GOMAXPROCS if zero or negative
+}
+
+// Report is the result of a Job run by Run.
+type Report struct {
+	File   tsfio.Filename // path of the file
+	Status Status         // status of the file after FinishFile, StatusNone if it failed or did not run
+	Err    error          // error of the job, nil on success
+}
+
+// Run generates the Codefiles of jobs in parallel with a bounded pool of workers configured by a, which may be nil.
+// A failed job does not stop the other jobs. If ctx is canceled, jobs not yet started are not run and report the
+// error of ctx. Run returns one Report per job in the order of jobs and an error joining the errors of all failed
+// jobs, or nil if all jobs succeeded. It returns an error without running any job, if a job has no Codefile or
+// Generator or if a Codefile is part of more than one job.
+func Run(ctx context.Context, jobs []Job, a *RunArgs) ([]Report, error) {
+	// Return an error in case ctx is nil
+	if ctx == nil {
+		return nil, tserr.NilPtr()
+	}
+	// Return an error in case of an invalid job
+	seen := make(map[*Codefile]bool, len(jobs))
+	for _, j := range jobs {
+		if j.File == nil || j.Generator == nil {
+			return nil, tserr.NilPtr()
+		}
+		if seen[j.File] {
+			return nil, tserr.Duplicate(string(j.File.fp))
+		}
+		seen[j.File] = true
+	}
+	// Retrieve the number of workers
+	w := runtime.GOMAXPROCS(0)
+	if a != nil && a.Workers > 0 {
+		w = a.Workers
+	}
+	w = min(w, len(jobs))
+	// Feed the indexes of the jobs to the workers
+	rs := make([]Report, len(jobs))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for k := 0; k < w; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				rs[i] = run(ctx, jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+	// Join the errors of the failed jobs in the order of jobs
+	var es []error
+	for _, r := range rs {
+		if r.Err != nil {
+			es = append(es, r.Err)
+		}
+	}
+	// Return the reports and the joined errors
+	return rs, errors.Join(es...)
+}
+
+// run runs job j, unless ctx is canceled, and returns its report.
+func run(ctx context.Context, j Job) Report {
+	r := Report{File: j.File.fp}
+	// Return the error of ctx, if it is canceled
+	if e := ctx.Err(); e != nil {
+		r.Err = tserr.Op(&tserr.OpArgs{Op: "Run", Fn: string(r.File), Err: e})
+		return r
+	}
+	// Generate the file
+	if e := j.File.Generate(j.Generator); e != nil {
+		r.Err = tserr.Op(&tserr.OpArgs{Op: "Run", Fn: string(r.File), Err: e})
+		return r
+	}
+	// Return the report with the status of the file
+	r.Status = j.File.Status()
+	return r
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode, tserr and tsfio
+import (
+	"context"       // context
+	"errors"        // errors
+	"fmt"           // fmt
+	"path/filepath" // filepath
+	"sync/atomic"   // atomic
+	"testing"       // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+	"github.com/thorstenrie/tsfio"  // tsfio
+)
+
+// testJobs is the number of jobs run by the runner tests
+const testJobs = 20
+
+// newJobs returns testJobs jobs generating files in a temporary directory. Every fifth job fails with a syntax error.
+// The generators count the number of jobs running in parallel in cur and keep the maximum in peak.
+func newJobs(t *testing.T, cur, peak *atomic.Int64) []lpcode.Job {
+	d := tsfio.Directory(t.TempDir())
+	jobs := make([]lpcode.Job, testJobs)
+	for i := range jobs {
+		// Retrieve the Codefile
+		cf, e := lpcode.NewCodefile(d, tsfio.Filename(fmt.Sprintf("f%02d.go", i)))
+		if e != nil {
+			t.Fatal(tserr.Op(&tserr.OpArgs{Op: "NewCodefile", Fn: string(d), Err: e}))
+		}
+		// Generate a package clause and, for every fifth job, a syntax error
+		fail := i%5 == 0
+		jobs[i] = lpcode.Job{File: cf, Generator: func(c *lpcode.Code) error {
+			n := cur.Add(1)
+			defer cur.Add(-1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			c.Ident("package " + testKey + "\n")
+			if fail {
+				c.Call(testCall)
+			}
+			return nil
+		}}
+	}
+	// Return the jobs
+	return jobs
+}
+
+// TestRun tests Run to generate all files with a bounded number of workers and to report every failed file.
+// The test fails if more jobs run in parallel than workers, if the reports are not in the order of the jobs or
+// if the joined error does not contain every failed file.
+func TestRun(t *testing.T) {
+	// Run the jobs with two workers
+	var cur, peak atomic.Int64
+	jobs := newJobs(t, &cur, &peak)
+	rs, e := lpcode.Run(context.Background(), jobs, &lpcode.RunArgs{Workers: 2})
+	// The test fails if more jobs run in parallel than workers
+	if peak.Load() > 2 {
+		t.Error(tserr.Lower(&tserr.LowerArgs{Var: "parallel jobs", Actual: peak.Load(), Want: 3}))
+	}
+	// The test fails if the reports are not in the order of the jobs or do not report the result of the job
+	if len(rs) != testJobs {
+		t.Fatal(tserr.Equal(&tserr.EqualArgs{Var: "reports", Actual: int64(len(rs)), Want: testJobs}))
+	}
+	for i, r := range rs {
+		if r.File != jobs[i].File.Filepath() || (r.Err != nil) != (i%5 == 0) || (r.Err == nil && r.Status != lpcode.StatusCreated) {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "report", Actual: fmt.Sprint(r), Want: string(jobs[i].File.Filepath())}))
+		}
+	}
+	// The test fails if the joined error does not contain every failed file
+	var fe *lpcode.FormatError
+	if !errors.As(e, &fe) {
+		t.Fatal(tserr.NilFailed("Run"))
+	}
+	if n := len(e.(interface{ Unwrap() []error }).Unwrap()); n != testJobs/5 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "errors", Actual: int64(n), Want: testJobs / 5}))
+	}
+}
+
+// TestRunCanceled tests Run with a canceled context. The test fails if a job is run, if a report does not contain
+// the error of the context or if a file is written.
+func TestRunCanceled(t *testing.T) {
+	// Run the jobs with a canceled context
+	var cur, peak atomic.Int64
+	jobs := newJobs(t, &cur, &peak)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rs, e := lpcode.Run(ctx, jobs, nil)
+	// The test fails if a job is run or if a report does not contain the error of the context
+	if peak.Load() != 0 || !errors.Is(e, context.Canceled) {
+		t.Error(tserr.NilFailed("Run"))
+	}
+	for _, r := range rs {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Error(tserr.Op(&tserr.OpArgs{Op: "Run", Fn: string(r.File), Err: r.Err}))
+		}
+	}
+	// The test fails if a file is written
+	if m, _ := filepath.Glob(filepath.Join(filepath.Dir(string(jobs[0].File.Filepath())), "*.go")); len(m) != 0 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "files", Actual: int64(len(m)), Want: 0}))
+	}
+}
+
+// TestRunErr tests Run to return an error without running any job for invalid arguments. The test fails if
+// a nil context, a job without Generator or a duplicate Codefile does not return an error.
+func TestRunErr(t *testing.T) {
+	// Retrieve the jobs
+	var cur, peak atomic.Int64
+	jobs := newJobs(t, &cur, &peak)
+	// The test fails if invalid arguments do not return an error
+	var ctx context.Context
+	if _, e := lpcode.Run(ctx, jobs, nil); e == nil {
+		t.Error(tserr.NilFailed("Run with nil context"))
+	}
+	if _, e := lpcode.Run(context.Background(), []lpcode.Job{{File: jobs[0].File}}, nil); e == nil {
+		t.Error(tserr.NilFailed("Run without Generator"))
+	}
+	if _, e := lpcode.Run(context.Background(), []lpcode.Job{jobs[0], jobs[0]}, nil); e == nil {
+		t.Error(tserr.NilFailed("Run with duplicate Codefile"))
+	}
+	// The test fails if a job is run
+	if peak.Load() != 0 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "jobs run", Actual: peak.Load(), Want: 0}))
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"slices" // slices
+	"sync"   // sync
+)
+
+// Sections is source code divided into named sections. Code itself is not safe for concurrent use, Sections is:
+// independent goroutines may retrieve sections with Section and append to them concurrently. Code assembles the
+// sections in a deterministic order, regardless of the order in which the goroutines ran.
+type Sections struct {
+	mu    sync.Mutex          // protects order and secs
+	order []string            // names of the sections in the order of NewSections
+	secs  map[string]*Section // sections by name
+}
+
+// Section is a named section of Sections. Its methods are safe for concurrent use.
+type Section struct {
+	mu   sync.Mutex // protects code
+	name string     // name of the section
+	code Code       // source code of the section
+}
+
+// NewSections returns new, empty Sections. The sections named by names are assembled first in the
+// order of names, all other sections follow sorted by name.
+func NewSections(names ...string) *Sections {
+	// Return the new Sections
+	return &Sections{order: slices.Clone(names), secs: make(map[string]*Section)}
+}
+
+// Section returns the section named name. The section is created, if it does not exist.
+// It returns nil, if s is nil.
+func (s *Sections) Section(name string) *Section {
+	// Return nil in case s is nil
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Create the section, if it does not exist
+	sec, ok := s.secs[name]
+	if !ok {
+		sec = &Section{name: name}
+		s.secs[name] = sec
+	}
+	// Return the section
+	return sec
+}
+
+// Code returns the source code of all sections assembled in a deterministic order: first the sections named
+// in NewSections in their order, then all other sections sorted by name. The builder calls recorded in the sections
+// are kept, so that format errors point to the builder call which produced the offending lines. It returns nil, if s is nil.
+func (s *Sections) Code() *Code {
+	// Return nil in case s is nil
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Retrieve the sections not named in NewSections sorted by name
+	var other []string
+	for n := range s.secs {
+		if !slices.Contains(s.order, n) {
+			other = append(other, n)
+		}
+	}
+	slices.Sort(other)
+	// Assemble the sections
+	c := NewCode()
+	for _, n := range append(slices.Clone(s.order), other...) {
+		if sec, ok := s.secs[n]; ok {
+			sec.mu.Lock()
+			c.addCode(&sec.code)
+			sec.mu.Unlock()
+		}
+	}
+	// Return the assembled source code
+	return c
+}
+
+// Name returns the name of the section. It returns an empty string, if sec is nil.
+func (sec *Section) Name() string {
+	// Return an empty string in case sec is nil
+	if sec == nil {
+		return ""
+	}
+	// Return the name
+	return sec.name
+}
+
+// Append appends the source code of c to the section and returns the section. Appends to the same section are
+// kept in the order of the calls. The builder calls recorded in c are kept. It returns nil, if sec is nil.
+func (sec *Section) Append(c *Code) *Section {
+	// Return nil in case sec is nil
+	if sec == nil {
+		return nil
+	}
+	// Return the section, if c is nil
+	if c == nil {
+		return sec
+	}
+	sec.mu.Lock()
+	defer sec.mu.Unlock()
+	// Append the source code of c
+	sec.code.addCode(c)
+	// Return the section
+	return sec
+}
+
+// String returns the source code of the section. It returns an empty string, if sec is nil.
+func (sec *Section) String() string {
+	// Return an empty string in case sec is nil
+	if sec == nil {
+		return ""
+	}
+	sec.mu.Lock()
+	defer sec.mu.Unlock()
+	// Return the source code
+	return sec.code.String()
+}
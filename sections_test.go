@@ -0,0 +1,62 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"fmt"     // fmt
+	"strings" // strings
+	"sync"    // sync
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestSections tests goroutines appending to sections concurrently. The test fails if the assembled source code
+// is not in the deterministic order of the sections or if it differs between runs.
+func TestSections(t *testing.T) {
+	// assemble appends to the sections from one goroutine per section and returns the assembled source code
+	assemble := func() string {
+		s := lpcode.NewSections("types", "funcs")
+		var wg sync.WaitGroup
+		for _, n := range []string{"funcs", "zeta", "types", "alpha"} {
+			wg.Add(1)
+			go func(n string) {
+				defer wg.Done()
+				sec := s.Section(n)
+				for i := 0; i < 100; i++ {
+					sec.Append(lpcode.NewCode().LineComment(fmt.Sprintf("%v %d", n, i)))
+				}
+			}(n)
+		}
+		wg.Wait()
+		return s.Code().String()
+	}
+	// The test fails if the sections are not in the order types, funcs, alpha and zeta
+	c := assemble()
+	want := []string{"// types 0", "// types 99", "// funcs 0", "// funcs 99", "// alpha 0", "// alpha 99", "// zeta 0", "// zeta 99"}
+	for i := 1; i < len(want); i++ {
+		if strings.Index(c, want[i-1]+"\n") > strings.Index(c, want[i]+"\n") {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "order", Actual: want[i] + " before " + want[i-1], Want: want[i-1] + " before " + want[i]}))
+		}
+	}
+	// The test fails if the source code differs between runs
+	for i := 0; i < 10; i++ {
+		if a := assemble(); a != c {
+			t.Fatal(tserr.EqualStr(&tserr.EqualStrArgs{Var: "assembled source code", Actual: a, Want: c}))
+		}
+	}
+}
+
+// TestSectionsNil tests the methods of nil Sections and a nil Section. The test fails if they do not return nil or empty strings.
+func TestSectionsNil(t *testing.T) {
+	// Retrieve nil Sections
+	var s *lpcode.Sections
+	// The test fails if the methods do not return nil or empty strings
+	if s.Section(testKey) != nil || s.Code() != nil || s.Section(testKey).Append(lpcode.NewCode()) != nil ||
+		s.Section(testKey).Name() != "" || s.Section(testKey).String() != "" {
+		t.Error(tserr.NotNil("Sections"))
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"slices"      // slices
+	"sync/atomic" // atomic
+)
+
+// generations provides unique generations to Code, so that snapshots of a Code are not valid after
+// Format or Reset and not valid for its copies
+var generations atomic.Int64
+
+// Mark is a snapshot of Code returned by Mark. Rollback discards all source code, imports, declarations and directives
+// added to Code after the snapshot was taken and restores the placeholders filled by Fill.
+type Mark struct {
+	gen   int64          // generation of the Code
+	off   int            // length of the source code
+	spans int            // number of recorded builder calls
+	imps  int            // number of imports
+	phs   int            // number of placeholders
+	decls [partCount]int // number of declarations in each part
+	doc   string         // doc comment attached to the next declaration
+	dirs  string         // directives attached to the next declaration
+	cons  int            // number of build constraints
+	errs  int            // number of errors of invalid directives
+	embs  int            // number of variables generated by EmbedVar
+	fills []*Code        // source code filling the placeholders
+}
+
+// Mark returns a snapshot of code, which can be restored with Rollback. A snapshot is invalidated by Format and Reset.
+// It returns the zero Mark, if code is nil.
+func (code *Code) Mark() Mark {
+	// Return the zero Mark in case code is nil
+	if code == nil {
+		return Mark{}
+	}
+	// Retrieve the snapshot
+	m := Mark{gen: code.gen, off: code.b.Len(), spans: len(code.spans), imps: len(code.imps), phs: len(code.phs), doc: code.doc,
+		dirs: code.dirs, cons: len(code.cons), errs: len(code.errs), embs: len(code.embs)}
+	for s := range code.decls {
+		m.decls[s] = len(code.decls[s])
+	}
+	// Retrieve the source code filling the placeholders, which is replaced in place by Fill
+	m.fills = fills(nil, code.phs)
+	for s := range code.decls {
+		for _, d := range code.decls[s] {
+			m.fills = fills(m.fills, d.phs)
+		}
+	}
+	// Return the snapshot
+	return m
+}
+
+// Rollback restores the snapshot m of code taken by Mark. All source code, imports, declarations and placeholders added after the
+// snapshot was taken are discarded, placeholders filled by Fill after the snapshot was taken are restored. Rollback leaves code unchanged, if m was not taken from code or was invalidated
+// by Format or Reset. It returns nil, if code is nil.
+func (code *Code) Rollback(m Mark) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Return code, if m is invalid
+	if m.gen != code.gen || m.off > code.b.Len() || m.spans > len(code.spans) || m.imps > len(code.imps) || m.phs > len(code.phs) ||
+		m.cons > len(code.cons) || m.errs > len(code.errs) || m.embs > len(code.embs) {
+		return code
+	}
+	for s := range code.decls {
+		if m.decls[s] > len(code.decls[s]) {
+			return code
+		}
+	}
+	// Discard the source code, builder calls, imports and declarations added after m
+	code.b.Truncate(m.off)
+	code.spans = code.spans[:m.spans]
+	code.imps = code.imps[:m.imps]
+	code.phs = code.phs[:m.phs]
+	code.doc, code.dirs = m.doc, m.dirs
+	code.cons, code.errs, code.embs = code.cons[:m.cons], code.errs[:m.errs], code.embs[:m.embs]
+	for s := range code.decls {
+		code.decls[s] = code.decls[s][:m.decls[s]]
+	}
+	// Restore the source code filling the placeholders
+	fs := restoreFills(code.phs, m.fills)
+	for s := range code.decls {
+		for _, d := range code.decls[s] {
+			fs = restoreFills(d.phs, fs)
+		}
+	}
+	// Return code
+	return code
+}
+
+// Len returns the length of the source code in code in bytes, without the imports and declarations
+// added to its parts. It returns zero, if code is nil.
+func (code *Code) Len() int {
+	// Return zero in case code is nil
+	if code == nil {
+		return 0
+	}
+	// Return the length of the source code
+	return code.b.Len()
+}
+
+// Reset discards the source code, imports and declarations in code and invalidates all snapshots taken by Mark.
+// The Formatter set by SetFormatter is kept. It returns nil, if code is nil.
+func (code *Code) Reset() *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Discard the source code, builder calls, imports and declarations
+	code.b.Reset()
+	code.spans, code.imps, code.decls, code.phs = nil, nil, [partCount][]*Code{}, nil
+	code.doc, code.dirs, code.cons, code.errs, code.embs = "", "", nil, nil, nil
+	// Invalidate the snapshots
+	code.gen = generations.Add(1)
+	// Return code
+	return code
+}
+
+// Clone returns an independent copy of code with its source code, recorded builder calls, imports, declarations,
+// placeholders, Formatter and tracing, so that a generator can try an alternative on the copy. Filling a placeholder
+// of the copy does not fill the original. Snapshots taken from code are not valid for the copy. It returns nil, if code is nil.
+func (code *Code) Clone() *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Copy code with its placeholders, which are filled in place by Fill
+	c := &Code{fm: code.fm, trc: code.trc, spans: slices.Clone(code.spans), imps: slices.Clone(code.imps),
+		phs: clonePlaceholders(code.phs), doc: code.doc, dirs: code.dirs, cons: slices.Clone(code.cons),
+		errs: slices.Clone(code.errs), embs: slices.Clone(code.embs), gen: generations.Add(1)}
+	c.b.Write(code.b.Bytes())
+	// Copy the declarations, since their placeholders are filled in place by Fill
+	for s := range code.decls {
+		if code.decls[s] != nil {
+			c.decls[s] = make([]*Code, len(code.decls[s]))
+		}
+		for i, d := range code.decls[s] {
+			c.decls[s][i] = d.Clone()
+		}
+	}
+	// Return the copy
+	return c
+}
+
+// clonePlaceholders returns a copy of phs with copies of the source code filling the placeholders.
+func clonePlaceholders(phs []placeholder) []placeholder {
+	c := slices.Clone(phs)
+	for i := range c {
+		c[i].fill = c[i].fill.Clone()
+	}
+	return c
+}
+
+// fills appends the source code filling the placeholders in phs to fs, followed by the source code filling the
+// placeholders it contains, and returns fs.
+func fills(fs []*Code, phs []placeholder) []*Code {
+	for _, p := range phs {
+		fs = append(fs, p.fill)
+		if p.fill != nil {
+			fs = fills(fs, p.fill.phs)
+		}
+	}
+	return fs
+}
+
+// restoreFills fills the placeholders in phs and in the source code filling them with the source code in fs
+// in the order of fills and returns the remaining source code in fs.
+func restoreFills(phs []placeholder, fs []*Code) []*Code {
+	for i := range phs {
+		// Return, if fs is exhausted
+		if len(fs) == 0 {
+			return nil
+		}
+		phs[i].fill, fs = fs[0], fs[1:]
+		if phs[i].fill != nil {
+			fs = restoreFills(phs[i].fill.phs, fs)
+		}
+	}
+	return fs
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"errors"  // errors
+	"strings" // strings
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestRollback tests Rollback to discard the source code, imports and declarations added after Mark.
+// The test fails if the source code after Rollback differs from the source code at Mark.
+func TestRollback(t *testing.T) {
+	// Generate source code and take a snapshot
+	c := lpcode.NewCode().Ident("package " + testKey + "\n").Import("fmt")
+	want, n := c.String(), c.Len()
+	m := c.Mark()
+	// Speculatively add source code, an import and a declaration
+	c.Ident("func speculative() {}\n").Import("os").Declare(lpcode.PartConsts, lpcode.NewCode().Ident("const x = 1\n"))
+	// The test fails if the source code after Rollback differs from the source code at Mark
+	if a := c.Rollback(m).String(); a != want || c.Len() != n {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Rollback", Actual: a, Want: want}))
+	}
+}
+
+// TestRollbackFill tests Rollback to restore placeholders filled by Fill after Mark, also in declarations and in
+// the source code filling other placeholders. The test fails if the source code after Rollback differs from the
+// source code at Mark or if Format does not return an error for the unfilled placeholder.
+func TestRollbackFill(t *testing.T) {
+	// Generate source code with placeholders and fill the outer placeholder
+	c := lpcode.NewCode().Ident("package "+testKey+"\n").Placeholder("f").
+		Declare(lpcode.PartVars, lpcode.NewCode().Ident("var x = ").Placeholder("v").Ident("\n"))
+	if e := c.Fill("f", lpcode.NewCode().Ident("var y = ").Placeholder("w").Ident("\n")); e != nil {
+		t.Fatal(e)
+	}
+	want := c.String()
+	m := c.Mark()
+	// Speculatively fill the placeholders
+	e := errors.Join(c.Fill("v", lpcode.NewCode().Ident("1")), c.Fill("w", lpcode.NewCode().Ident("2")),
+		c.Fill("f", lpcode.NewCode().Ident("var z = 3\n")))
+	if e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if the source code after Rollback differs from the source code at Mark
+	if a := c.Rollback(m).String(); a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Rollback", Actual: a, Want: want}))
+	}
+	// The test fails if Format does not return an error for the unfilled placeholders
+	if e := c.Format(); e == nil {
+		t.Error(tserr.NilFailed("Format"))
+	}
+}
+
+// TestRollbackInvalid tests Rollback to leave Code unchanged for snapshots invalidated by Reset or taken from another Code.
+// The test fails if Rollback changes the source code.
+func TestRollbackInvalid(t *testing.T) {
+	// Take a snapshot and reset the Code
+	c := lpcode.NewCode().Ident(testIdent)
+	m := c.Mark()
+	c.Reset().Ident(testKey + testKey)
+	// The test fails if the invalidated snapshot changes the source code
+	if a := c.Rollback(m).String(); a != testKey+testKey {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Rollback after Reset", Actual: a, Want: testKey + testKey}))
+	}
+	// The test fails if the snapshot of another Code changes the source code
+	d := c.Clone()
+	if a := d.Rollback(c.Mark()).Ident(testIdent).String(); a != testKey+testKey+testIdent {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Rollback of Clone", Actual: a, Want: testKey + testKey + testIdent}))
+	}
+}
+
+// TestClone tests Clone to return an independent copy. The test fails if changing the copy changes the original
+// or if the copy does not contain the source code and imports of the original.
+func TestClone(t *testing.T) {
+	// Clone the Code and try an alternative on the copy
+	c := lpcode.NewCode().Ident("package " + testKey + "\n").Import("fmt")
+	want := c.String()
+	d := c.Clone()
+	d.Ident("var x = 1\n").Import("os")
+	// The test fails if the original is changed
+	if a := c.String(); a != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "original", Actual: a, Want: want}))
+	}
+	// The test fails if the copy does not contain the source code and imports of the original
+	if a, w := d.String(), "package "+testKey+"\n\nimport (\n\"fmt\"\n\"os\"\n)\n\nvar x = 1\n"; a != w {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "copy", Actual: a, Want: w}))
+	}
+	// Clone Code with placeholders in a declaration and in a filled placeholder and fill them in the copy
+	c = lpcode.NewCode().Declare(lpcode.PartVars, lpcode.NewCode().Ident("var x = ").Placeholder("v").Ident("\n")).
+		Placeholder("f")
+	if e := c.Fill("f", lpcode.NewCode().Ident("var y = ").Placeholder("w").Ident("\n")); e != nil {
+		t.Fatal(e)
+	}
+	want = c.String()
+	d = c.Clone()
+	if e := errors.Join(d.Fill("v", lpcode.NewCode().Ident("42")), d.Fill("w", lpcode.NewCode().Ident("43"))); e != nil {
+		t.Fatal(e)
+	}
+	// The test fails if filling the placeholders of the copy fills the placeholders of the original
+	if a := c.String(); a != want || strings.Contains(a, "42") || strings.Contains(a, "43") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "original", Actual: a, Want: want}))
+	}
+	if a := d.String(); !strings.Contains(a, "var x = 42") || !strings.Contains(a, "var y = 43") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "copy", Actual: a, Want: "var x = 42"}))
+	}
+}
+
+// TestSnapshotNil tests Mark, Rollback, Len, Reset and Clone of nil Code. The test fails if they do not return nil or zero.
+func TestSnapshotNil(t *testing.T) {
+	// Retrieve nil Code
+	var c *lpcode.Code
+	// The test fails if the methods do not return nil or zero
+	if c.Rollback(c.Mark()) != nil || c.Len() != 0 || c.Reset() != nil || c.Clone() != nil {
+		t.Error(tserr.NotNil("Code"))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages and tserr
+import (
+	"fmt"    // fmt
+	"slices" // slices
+
+	"github.com/thorstenrie/tserr" // tserr
+)
+
+// State is the lifecycle state of a Codefile. A new Codefile is in StateNew. StartFile moves it to StateStarted,
+// which allows writing the contents. FinishFile moves it to StateFinished on success and to StateFailed on failure.
+// From StateFinished and StateFailed, StartFile starts the file again.
+type State int
+
+// States of a Codefile
+const (
+	// StateNew is the state of a new Codefile.
+	StateNew State = iota
+	// StateStarted is the state after StartFile succeeded. The contents can be written.
+	StateStarted
+	// StateFinished is the state after FinishFile succeeded.
+	StateFinished
+	// StateFailed is the state after StartFile, FinishFile or Generate failed.
+	StateFailed
+)
+
+// stateNames contains the names of the states
+var stateNames = map[State]string{
+	StateNew:      "new",
+	StateStarted:  "started",
+	StateFinished: "finished",
+	StateFailed:   "failed",
+}
+
+// String returns the name of state s.
+func (s State) String() string {
+	// Return the name of s, if it is known
+	if n, ok := stateNames[s]; ok {
+		return n
+	}
+	// Return unknown otherwise
+	return "unknown"
+}
+
+// StateError is returned wrapped by the methods of a Codefile, if they are called in a state
+// which does not allow them, for example WriteCode before StartFile or FinishFile twice.
+type StateError struct {
+	Op    string // called method
+	State State  // state of the Codefile
+}
+
+// Error returns the error message.
+func (e *StateError) Error() string {
+	// Return an empty string if e is nil
+	if e == nil {
+		return ""
+	}
+	// Return the error message
+	return fmt.Sprintf("%v is not allowed in state %v", e.Op, e.State)
+}
+
+// require returns an error wrapping a StateError, if the state of cf is not one of states.
+func (cf *Codefile) require(op string, states ...State) error {
+	if slices.Contains(states, cf.lcs) {
+		return nil
+	}
+	return tserr.Op(&tserr.OpArgs{Op: op, Fn: string(cf.fp), Err: &StateError{Op: op, State: cf.lcs}})
+}
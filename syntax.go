@@ -7,17 +7,37 @@ package lpcode
 
 // Import Go standard library packages and tserr
 import (
-	"fmt"       // fmt
-	"go/format" // format
+	"bytes"  // bytes
+	"errors" // errors
+	"io"     // io
+	"slices" // slices
 
 	"github.com/thorstenrie/tserr" // tserr
 )
 
 // Code contains the source code as string. The source code is amended by
 // its methods. The source code can be retrieved with String and formatted
-// with Format.
+// with Format. The source code is stored in a buffer and builder calls write directly
+// into it, so the cost of generating source code grows linearly with its size.
+// Each builder call is recorded together with its call site, so errors returned
+// by Format point to the builder call which produced the offending source code.
+// Imports and declarations can be added to named parts with Import and Declare,
+// which are emitted in canonical Go order. A doc comment set with Doc and directives are
+// attached to the next declaration.
 type Code struct {
-	c string // the source code
+	b     bytes.Buffer       // the source code
+	spans spans              // builder calls which produced the source code
+	fm    Formatter          // formatter used by Format, Gofmt if nil
+	trc   bool               // record the call sites of the builder calls
+	imps  []string           // import paths of the imports part
+	decls [partCount][]*Code // declarations of the parts
+	gen   int64              // generation of the snapshots taken by Mark
+	phs   []placeholder      // placeholders filled by Fill
+	doc   string             // doc comment attached to the next declaration
+	dirs  string             // directives attached to the next declaration
+	cons  []string           // build constraints
+	errs  []error            // errors of invalid directives
+	embs  []embedSpec        // patterns of the variables generated by EmbedVar
 }
 
 // NewCode returns a pointer to a new Code instance.
@@ -35,8 +55,146 @@ func (code *Code) String() string {
 		// Return an empty string
 		return ""
 	}
-	// Return the source code as string
-	return code.c
+	// Return the source code with the parts emitted as string
+	return code.canonical().b.String()
+}
+
+// SetFormatter sets the Formatter f used by Format. If f is nil, Format uses Gofmt.
+func (code *Code) SetFormatter(f Formatter) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Set the formatter
+	code.fm = f
+	// Return code
+	return code
+}
+
+// SetTrace sets whether the call site of each builder call in the generator is recorded, so that a FormatError
+// returned by Format points to the file and line of the offending builder call. Retrieving the call site unwinds the
+// call stack for each builder call, so that tracing is disabled by default. The builder call itself is always recorded.
+// Tracing only applies to builder calls after SetTrace.
+func (code *Code) SetTrace(t bool) *Code {
+	// Return nil in case code is nil
+	if code == nil {
+		return nil
+	}
+	// Set tracing
+	code.trc = t
+	// Return code
+	return code
+}
+
+// Write appends p as raw source code to code. It implements io.Writer, so that for example
+// fmt.Fprintf or text/template can add source code to code. It returns an error if code is nil.
+// Since Code has a Format method returning an error, Code does not implement fmt.Formatter.
+// The verbs %v, %s and %q are supported by String.
+func (code *Code) Write(p []byte) (int, error) {
+	// Return an error in case code is nil
+	if code == nil {
+		return 0, tserr.NilPtr()
+	}
+	// Add p to code
+	code.add("Write", string(p))
+	// Return the number of bytes written
+	return len(p), nil
+}
+
+// WriteTo writes the source code in code to w. It implements io.WriterTo, so that the source code
+// can be streamed into files, hashers or HTTP responses without copying it. The source code in code
+// remains unchanged. It returns the number of bytes written and an error if code is nil or if writing
+// to w fails.
+func (code *Code) WriteTo(w io.Writer) (int64, error) {
+	// Return an error in case code is nil
+	if code == nil {
+		return 0, tserr.NilPtr()
+	}
+	// Write the source code to w
+	n, e := w.Write(code.canonical().b.Bytes())
+	// Return the number of bytes written and the error, if any
+	return int64(n), e
+}
+
+// add appends the strings s to the source code in code and records the builder call op
+// together with its call site in the generator.
+func (code *Code) add(op string, s ...string) {
+	// Retrieve the offset of s in the source code
+	start := code.b.Len()
+	// Append s to the source code
+	for _, v := range s {
+		code.b.WriteString(v)
+	}
+	// Record the builder call and the call site of the builder call
+	code.spans = code.spans.record(op, start, code.b.Len(), code.trc)
+}
+
+// addCode appends the source code in c to code. The builder calls recorded in c are kept.
+func (code *Code) addCode(c *Code) {
+	// Append the recorded builder calls of c with offsets moved to the end of the source code
+	code.spans = append(code.spans, c.spans.shift(code.b.Len())...)
+	// Append the placeholders of c with offsets moved to the end of the source code
+	for _, p := range c.phs {
+		p.off += code.b.Len()
+		code.phs = append(code.phs, p)
+	}
+	// Append the source code of c
+	code.b.Write(c.b.Bytes())
+	// Add the imports and declarations of c
+	code.merge(c)
+}
+
+// insertCode splices the source code of c into code at offset off. The builder calls recorded in c are kept.
+func (code *Code) insertCode(off int, c *Code) {
+	// Retrieve the source code after off
+	tail := bytes.Clone(code.b.Bytes()[off:])
+	// Insert the source code of c
+	code.b.Truncate(off)
+	code.b.Write(c.b.Bytes())
+	code.b.Write(tail)
+	// Move the recorded builder calls after off and insert the builder calls of c at their position
+	i := len(code.spans)
+	for j := range code.spans {
+		if code.spans[j].start >= off {
+			i = min(i, j)
+			code.spans[j].start += c.b.Len()
+			code.spans[j].end += c.b.Len()
+		}
+	}
+	code.spans = slices.Insert(code.spans, i, c.spans.shift(off)...)
+	// Move the placeholders after off and insert the placeholders of c at their position
+	k := len(code.phs)
+	for j := range code.phs {
+		if code.phs[j].off > off || (code.phs[j].off == off && c.b.Len() > 0) {
+			k = min(k, j)
+			code.phs[j].off += c.b.Len()
+		}
+	}
+	for j, p := range c.phs {
+		p.off += off
+		code.phs = slices.Insert(code.phs, k+j, p)
+	}
+}
+
+// insert inserts s at offset off into the source code in code and records the builder call op together
+// with its call site in the generator. The recorded builder calls after off are moved accordingly.
+func (code *Code) insert(off int, op string, s string) {
+	// Retrieve the source code after off
+	tail := bytes.Clone(code.b.Bytes()[off:])
+	// Insert s
+	code.b.Truncate(off)
+	code.b.WriteString(s)
+	code.b.Write(tail)
+	// Move the recorded builder calls after off and record the builder call at its position
+	i := len(code.spans)
+	for j := range code.spans {
+		if code.spans[j].start >= off {
+			i = min(i, j)
+			code.spans[j].start += len(s)
+			code.spans[j].end += len(s)
+		}
+	}
+	code.spans = slices.Insert(code.spans, i, newSpan(op, off, off+len(s), code.trc))
 }
 
 // LineComment adds a line comment and a new line to code: // c\n. The comment is provided by argument c.
@@ -46,7 +204,7 @@ func (code *Code) LineComment(c string) *Code {
 		return nil
 	}
 	// Add a line comment and a new line to code
-	code.c += fmt.Sprintf("// %v\n", c)
+	code.add("LineComment", "// ", c, "\n")
 	// Return code
 	return code
 }
@@ -58,7 +216,7 @@ func (code *Code) FuncEnd() *Code {
 		return nil
 	}
 	// Add a block end and two new lines to code
-	code.c += "}\n\n"
+	code.add("FuncEnd", "}\n\n")
 	// Return code
 	return code
 }
@@ -70,7 +228,7 @@ func (code *Code) BlockEnd() *Code {
 		return nil
 	}
 	// Add a block ending to code
-	code.c += "}\n"
+	code.add("BlockEnd", "}\n")
 	// Return code
 	return code
 }
@@ -83,7 +241,7 @@ func (code *Code) Call(n string) *Code {
 		return nil
 	}
 	// Add a function call to code
-	code.c += fmt.Sprintf("%v(", n)
+	code.add("Call", n, "(")
 	// Return code
 	return code
 }
@@ -95,7 +253,7 @@ func (code *Code) ParamEndln() *Code {
 		return nil
 	}
 	// Add a parameters ending and a new line to code
-	code.c += ")\n"
+	code.add("ParamEndln", ")\n")
 	// Return code
 	return code
 }
@@ -107,7 +265,7 @@ func (code *Code) ParamEnd() *Code {
 		return nil
 	}
 	// Add parameters ending to code
-	code.c += ")"
+	code.add("ParamEnd", ")")
 	// Return code
 	return code
 }
@@ -120,7 +278,8 @@ func (code *Code) Func1(a *Func1Args) *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += fmt.Sprintf("func %v(%v %v) %v {\n", a.Name, a.Var, a.Type, a.Return)
+	code.attach()
+	code.add("Func1", "func ", a.Name, "(", a.Var, " ", a.Type, ") ", a.Return, " {\n")
 	return code
 }
 
@@ -131,8 +290,9 @@ func (code *Code) TypeStruct(n string) *Code {
 	if code == nil {
 		return nil
 	}
-	// Add a type declaration for a struct type to code
-	code.c += fmt.Sprintf("type %v struct {\n", n)
+	// Add the doc comment and a type declaration for a struct type to code
+	code.attach()
+	code.add("TypeStruct", "type ", n, " struct {\n")
 	// Return code
 	return code
 }
@@ -150,8 +310,9 @@ func (code *Code) VarSpec(a *VarSpecArgs) *Code {
 	if code == nil {
 		return nil
 	}
-	// Add a variable specification to code
-	code.c += fmt.Sprintf("%v %v\n", a.Ident, a.Type)
+	// Add the doc comment and a variable specification to code
+	code.attach()
+	code.add("VarSpec", a.Ident, " ", a.Type, "\n")
 	// Return code
 	return code
 }
@@ -163,7 +324,7 @@ func (code *Code) List() *Code {
 		return nil
 	}
 	// Add an identifier list to code
-	code.c += ", "
+	code.add("List", ", ")
 	// Return code
 	return code
 }
@@ -175,7 +336,7 @@ func (code *Code) Listln() *Code {
 		return nil
 	}
 	// Add an identifier list and a new line to code
-	code.c += ",\n"
+	code.add("Listln", ",\n")
 	// Return code
 	return code
 }
@@ -196,7 +357,7 @@ func (code *Code) SelField(a *SelArgs) *Code {
 		return nil
 	}
 	// Add a field selector to code
-	code.c += fmt.Sprintf("%v.%v", a.Val, a.Sel)
+	code.add("SelField", a.Val, ".", a.Sel)
 	// Return code
 	return code
 }
@@ -213,7 +374,7 @@ func (code *Code) SelMethod(a *SelArgs) *Code {
 		return nil
 	}
 	// Add a method selector to code
-	code.c += fmt.Sprintf("%v.%v(", a.Val, a.Sel)
+	code.add("SelMethod", a.Val, ".", a.Sel, "(")
 	// Return code
 	return code
 }
@@ -228,7 +389,7 @@ func (code *Code) If(a *IfArgs) *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += fmt.Sprintf("if %v %v %v {\n", a.ExprLeft, a.Operator, a.ExprRight)
+	code.add("If", "if ", a.ExprLeft, " ", a.Operator, " ", a.ExprRight, " {\n")
 	return code
 }
 
@@ -241,7 +402,7 @@ func (code *Code) IfErr(a *IfErrArgs) *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += fmt.Sprintf("if err := %v; err %v nil {\n", a.Method, a.Operator)
+	code.add("IfErr", "if err := ", a.Method, "; err ", a.Operator, " nil {\n")
 	return code
 }
 
@@ -250,7 +411,7 @@ func (code *Code) Return() *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += "return "
+	code.add("Return", "return ")
 	return code
 }
 
@@ -259,7 +420,7 @@ func (code *Code) Addr() *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += "&"
+	code.add("Addr", "&")
 	return code
 }
 
@@ -270,7 +431,7 @@ func (code *Code) Ident(n string) *Code {
 		return nil
 	}
 	// Add identifier n to code
-	code.c += n
+	code.add("Ident", n)
 	// Return code
 	return code
 }
@@ -284,7 +445,7 @@ func (code *Code) Assignment(a *AssignmentArgs) *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += fmt.Sprintf("%v = %v", a.ExprLeft, a.ExprRight)
+	code.add("Assignment", a.ExprLeft, " = ", a.ExprRight)
 	return code
 }
 
@@ -293,7 +454,7 @@ func (code *Code) CompositeLit(LiteralType string) *Code {
 	if code == nil {
 		return nil
 	}
-	code.c += fmt.Sprintf("%v{", LiteralType)
+	code.add("CompositeLit", LiteralType, "{")
 	return code
 }
 
@@ -315,7 +476,7 @@ func (code *Code) ShortVarDecl(a *ShortVarDeclArgs) *Code {
 		return nil
 	}
 	// Add a short variable declaration to code
-	code.c += fmt.Sprintf("%v := %v\n", a.Ident, a.Expr)
+	code.add("ShortVarDecl", a.Ident, " := ", a.Expr, "\n")
 	// Return code
 	return code
 }
@@ -338,7 +499,7 @@ func (code *Code) KeyedElement(a *KeyedElementArgs) *Code {
 		return nil
 	}
 	// Add keyed element of a composite literal to code
-	code.c += fmt.Sprintf("%v: %v,\n", a.Key, a.Elem)
+	code.add("KeyedElement", a.Key, ": ", a.Elem, ",\n")
 	// Return code
 	return code
 }
@@ -381,32 +542,40 @@ func (code *Code) Testvariables(t *Testvars) *Code {
 	}
 	// If test variables exist, add them to the variable declaration
 	if text != "" {
-		code.c += "var (\n"
-		code.c += text
-		code.c += ")\n\n"
+		code.attach()
+		code.add("Testvariables", "var (\n", text, ")\n\n")
 	}
 	// Return generated code
 	return code
 }
 
-// Format formats the source code in code in canonical gfmt style.
-// It uses Source from the go/format package. Format returns an error
-// if code is nil or if go/format returns an error.
+// Format formats the source code in code with the Formatter set by SetFormatter.
+// By default, it formats the source code in canonical gofmt style using Gofmt. Format returns an error
+// if code is nil, if a placeholder is not filled, if a directive is invalid or if the Formatter returns an error. In case of a syntax error,
+// the returned error wraps a FormatError with the offending lines and the
+// builder call which produced them.
 func (code *Code) Format() error {
 	// Return an error in cae code is nil
 	if code == nil {
 		return tserr.NilPtr()
 	}
-	// Convert source code into a slice of bytes
-	b := []byte(code.c)
-	// Format the source code using Source from the go/format package
-	o, e := format.Source(b)
-	// Return an error in case Source fails
+	// Format the source code with the parts emitted and the placeholders filled using the formatter
+	src := code.canonical()
+	if e := errors.Join(src.invalid(), src.unfilled()); e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "format source", Fn: "code", Err: e})
+	}
+	o, e := formatSource(code.fm, src.b.Bytes(), src.spans)
+	// Return an error in case the formatter fails
 	if e != nil {
 		return tserr.Op(&tserr.OpArgs{Op: "format source", Fn: "code", Err: e})
 	}
-	// Convert the formatted source code to string and store it in code
-	code.c = string(o)
+	// Store the formatted source code in code
+	code.b.Reset()
+	code.b.Write(o)
+	// Reset the recorded builder calls, since they do not match the formatted source code, and the emitted parts
+	code.spans, code.imps, code.decls, code.phs, code.cons = nil, nil, [partCount][]*Code{}, nil, nil
+	// Invalidate the snapshots taken by Mark
+	code.gen = generations.Add(1)
 	// Return nil
 	return nil
 }
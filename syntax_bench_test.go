@@ -0,0 +1,65 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages fmt and testing as well as lpcode
+import (
+	"fmt"     // fmt
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+)
+
+// benchCalls contains the numbers of builder calls for the benchmarks. The reported
+// ns/call are expected to stay constant for all numbers of builder calls, since the
+// cost of generating source code grows linearly with its size.
+var benchCalls = []int{1000, 10000, 100000, 1000000}
+
+// BenchmarkKeyedElement benchmarks generating a composite literal with n keyed elements by KeyedElement.
+// It reports the time per builder call.
+func BenchmarkKeyedElement(b *testing.B) {
+	// Run the benchmark for each number of builder calls
+	for _, n := range benchCalls {
+		b.Run(fmt.Sprintf("calls=%d", n), func(b *testing.B) {
+			// Report allocations
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// Retrieve the short variable declaration with ShortVarDecl
+				c := lpcode.NewCode().ShortVarDecl(&lpcode.ShortVarDeclArgs{Ident: testIdent, Expr: testExpr + "{"})
+				// Retrieve n keyed elements with KeyedElement
+				for j := 0; j < n; j++ {
+					c.KeyedElement(&lpcode.KeyedElementArgs{Key: testKey, Elem: testElem})
+				}
+				// Retrieve the block ending with BlockEnd
+				c.BlockEnd()
+			}
+			// Report the time per builder call
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*(n+2)), "ns/call")
+		})
+	}
+}
+
+// BenchmarkCall benchmarks generating a function call with n identifiers by Call, Ident and List.
+// It reports the time per builder call.
+func BenchmarkCall(b *testing.B) {
+	// Run the benchmark for each number of builder calls
+	for _, n := range benchCalls {
+		b.Run(fmt.Sprintf("calls=%d", n), func(b *testing.B) {
+			// Report allocations
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// Retrieve the function call with Call
+				c := lpcode.NewCode().Call(testCall)
+				// Retrieve n identifiers with Ident separated by List
+				for j := 0; j < n; j += 2 {
+					c.Ident(testIdent).List()
+				}
+				// Retrieve the parameters ending with ParamEndln
+				c.ParamEndln()
+			}
+			// Report the time per builder call
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*(n+2)), "ns/call")
+		})
+	}
+}
@@ -5,6 +5,7 @@ package lpcode_test
 
 // Import Go standard library package testing as well as lpcode and tserr
 import (
+	"io"      // io
 	"testing" // testing
 
 	"github.com/thorstenrie/lpcode" // lpcode
@@ -253,3 +254,25 @@ func TestFormatNil(t *testing.T) {
 		t.Error(tserr.NilFailed("Format"))
 	}
 }
+
+// TestWriteNil tests Write to return an error in case
+// *Code is nil. The test fails if Write does not return an error.
+func TestWriteNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if Write does not return an error.
+	if _, e := c.Write([]byte(testIdent)); e == nil {
+		t.Error(tserr.NilFailed("Write"))
+	}
+}
+
+// TestWriteToNil tests WriteTo to return an error in case
+// *Code is nil. The test fails if WriteTo does not return an error.
+func TestWriteToNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if WriteTo does not return an error.
+	if _, e := c.WriteTo(io.Discard); e == nil {
+		t.Error(tserr.NilFailed("WriteTo"))
+	}
+}
@@ -5,6 +5,9 @@ package lpcode_test
 
 // Import Go standard library package testing as well as lpcode, tserr and tsfio
 import (
+	"bytes"   // bytes
+	"fmt"     // fmt
+	"strconv" // strconv
 	"testing" // testing
 
 	"github.com/thorstenrie/lpcode" // lpcode
@@ -178,3 +181,61 @@ func TestFormatNoCode(t *testing.T) {
 		t.Error(tserr.NilFailed("format code"))
 	}
 }
+
+// TestWrite tests source code added by fmt.Fprintf using Write. The test fails if
+// the source code does not match the contents of the golden file.
+func TestWrite(t *testing.T) {
+	// Retrieve a new Code instance
+	c := lpcode.NewCode()
+	// Add the function call with fmt.Fprintf
+	if _, e := fmt.Fprintf(c, "%v(%v, %v)\n", testCall, testIdent, testKey); e != nil {
+		// The test fails if Fprintf returns an error
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Fprintf", Fn: "code", Err: e}))
+	}
+	// Evaluate the retrieved source code
+	if e := evalCode(c, "call"); e != nil {
+		// The test fails if the generated source code does not match the contents of the golden file
+		t.Error(e)
+	}
+}
+
+// TestWriteTo tests WriteTo to write the source code to a buffer without changing the source code.
+// The test fails if the buffer or the source code do not match the expected source code.
+func TestWriteTo(t *testing.T) {
+	// Retrieve the function call
+	c := lpcode.NewCode().Call(testCall).Ident(testIdent).ParamEndln()
+	// Write the source code to a buffer
+	var b bytes.Buffer
+	n, e := c.WriteTo(&b)
+	// The test fails if WriteTo returns an error
+	if e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "WriteTo", Fn: "buffer", Err: e}))
+	}
+	// The test fails if the number of bytes written does not match the length of the source code
+	if n != int64(len(c.String())) {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "n", Actual: n, Want: int64(len(c.String()))}))
+	}
+	// The test fails if the buffer does not match the source code
+	if b.String() != c.String() {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "buffer", Actual: b.String(), Want: c.String()}))
+	}
+	// The test fails if the source code is changed by WriteTo
+	if c.String() != testCall+"("+testIdent+")\n" {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "code", Actual: c.String(), Want: testCall + "(" + testIdent + ")\n"}))
+	}
+}
+
+// TestVerbs tests formatting of Code with the verbs %v and %q. The test fails
+// if the formatted Code does not match the source code or the quoted source code.
+func TestVerbs(t *testing.T) {
+	// Retrieve the line comment
+	c := lpcode.NewCode().LineComment(testIdent)
+	// The test fails if %v does not return the source code
+	if v := fmt.Sprintf("%v", c); v != c.String() {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "%v", Actual: v, Want: c.String()}))
+	}
+	// The test fails if %q does not return the quoted source code
+	if q := fmt.Sprintf("%q", c); q != strconv.Quote(c.String()) {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "%q", Actual: q, Want: strconv.Quote(c.String())}))
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages
+import (
+	"bytes"      // bytes
+	"errors"     // errors
+	"fmt"        // fmt
+	"go/scanner" // scanner
+	"reflect"    // reflect
+	"runtime"    // runtime
+	"slices"     // slices
+	"strconv"    // strconv
+	"strings"    // strings
+)
+
+// contextLines is the number of generated lines preceding and following the offending line
+// shown in the context of a FormatError.
+const contextLines = 2
+
+// callFrames is the maximum number of stack frames searched for the call site of a builder call
+const callFrames = 32
+
+// skippedPackages contains the packages skipped to retrieve the call site of a builder call in the generator:
+// lpcode itself and the std library packages, which write to Code as io.Writer.
+var skippedPackages = []string{reflect.TypeOf(Code{}).PkgPath(), "fmt", "io", "text/template"}
+
+// span records the builder call which produced the source code between
+// offsets start and end. If traced, the program counter pc identifies the
+// call site of the builder call in the generator.
+type span struct {
+	start, end int     // offsets of the produced source code
+	op         string  // name of the builder call
+	pc         uintptr // program counter of the call site, zero if not traced
+}
+
+// spans is an ordered list of recorded spans.
+type spans []span
+
+// record appends a span for the source code between start and end produced by op. If trace is true,
+// the call site of the builder call in the generator is retrieved from the call stack.
+func (s spans) record(op string, start, end int, trace bool) spans {
+	// Append the span and return the list
+	return append(s, newSpan(op, start, end, trace))
+}
+
+// newSpan returns the span for the source code between start and end produced by op. If trace is true,
+// the call site of the builder call in the generator is retrieved from the call stack.
+func newSpan(op string, start, end int, trace bool) span {
+	// Return the span without call site, if not traced
+	if !trace {
+		return span{start: start, end: end, op: op}
+	}
+	// Return the span with the call site
+	return span{start: start, end: end, op: op, pc: callSite()}
+}
+
+// callSite returns the program counter of the call site of a builder call. It is the first frame on the call stack
+// outside of the skipped packages. Only the program counter is kept, it is resolved to file and line by caller,
+// if a FormatError is created. It returns zero, if the call site is not found.
+func callSite() uintptr {
+	// Retrieve the program counters of the call stack
+	var pc [callFrames]uintptr
+	n := runtime.Callers(1, pc[:])
+	fs := runtime.CallersFrames(pc[:n])
+	for {
+		// Return the first frame outside of the skipped packages
+		f, more := fs.Next()
+		if !slices.Contains(skippedPackages, funcPackage(f.Function)) {
+			// The program counter of the frame is the call instruction, it is kept as return address like from Callers
+			return f.PC + 1
+		}
+		// Return zero, if the call stack is exhausted
+		if !more {
+			return 0
+		}
+	}
+}
+
+// caller returns the call site of span s as file:line. It returns an empty string, if s is not traced.
+func (s *span) caller() string {
+	// Return an empty string, if s is not traced
+	if s.pc == 0 {
+		return ""
+	}
+	// Resolve the program counter to file and line
+	f, _ := runtime.CallersFrames([]uintptr{s.pc}).Next()
+	return f.File + ":" + strconv.Itoa(f.Line)
+}
+
+// funcPackage returns the package path of the fully qualified function name fn.
+func funcPackage(fn string) string {
+	// The package path ends with the first dot after the last slash
+	i := strings.LastIndex(fn, "/") + 1
+	if j := strings.Index(fn[i:], "."); j >= 0 {
+		return fn[:i+j]
+	}
+	return fn
+}
+
+// find returns the span containing offset off. If off is beyond the last span,
+// the last span is returned. It returns nil, if no spans are recorded.
+func (s spans) find(off int) *span {
+	// Return nil in case no spans are recorded
+	if len(s) == 0 {
+		return nil
+	}
+	// Search for the span containing off
+	for i := range s {
+		if off >= s[i].start && off < s[i].end {
+			return &s[i]
+		}
+	}
+	// Return the last span
+	return &s[len(s)-1]
+}
+
+// shift returns a copy of s with all offsets moved by d.
+func (s spans) shift(d int) spans {
+	// Allocate the copy
+	c := make(spans, len(s))
+	// Move all offsets by d
+	for i := range s {
+		c[i] = s[i]
+		c[i].start += d
+		c[i].end += d
+	}
+	// Return the copy
+	return c
+}
+
+// FormatError is returned wrapped by Format of Code and Codefile in case the source code
+// could not be formatted due to a syntax error. It contains the position of the first syntax error,
+// the offending generated lines and, if known, the builder call and its call site in the generator
+// which produced the offending source code.
+type FormatError struct {
+	File         string // path of the generated file, empty if unknown
+	Failed       string // path of the file holding the unformatted source code, empty if not written
+	Line, Column int    // position of the syntax error in the generated source code
+	Msg          string // error message of the formatter
+	Op           string // builder call which produced the offending source code, empty if unknown
+	Caller       string // call site of the builder call in the generator as file:line, empty if unknown or not traced
+	Context      string // offending generated line with a caret marking the column and the surrounding lines
+	Err          error  // error returned by the formatter
+}
+
+// Error returns the error message of e including the builder call, its call site and
+// the offending generated lines.
+func (e *FormatError) Error() string {
+	// Return an empty string if e is nil
+	if e == nil {
+		return ""
+	}
+	// Add position and message of the syntax error
+	m := fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Msg)
+	// Add the generated file, if known
+	if e.File != "" {
+		m = e.File + ":" + m
+	}
+	// Add the builder call and call site, if known
+	switch {
+	case e.Op != "" && e.Caller != "":
+		m += fmt.Sprintf(" (generated by %v at %v)", e.Op, e.Caller)
+	case e.Op != "":
+		m += fmt.Sprintf(" (generated by %v)", e.Op)
+	}
+	// Add the offending generated lines
+	if e.Context != "" {
+		m += "\n" + e.Context
+	}
+	// Add the file holding the unformatted source code, if written
+	if e.Failed != "" {
+		m += "\nunformatted source code written to " + e.Failed
+	}
+	// Return the error message
+	return m
+}
+
+// Unwrap returns the error returned by the formatter.
+func (e *FormatError) Unwrap() error {
+	// Return nil if e is nil
+	if e == nil {
+		return nil
+	}
+	// Return the error of the formatter
+	return e.Err
+}
+
+// formatSource formats src with Formatter f, or with Gofmt if f is nil. If formatting fails due to
+// a syntax error, the error is returned as FormatError enriched with the offending lines and the builder call
+// retrieved from s. The formatters of Formatters are applied one by one. The spans s only apply to src, so that
+// the builder call is only retrieved, if the failing formatter is applied to src unchanged by the formatters before it.
+func formatSource(f Formatter, src []byte, s spans) ([]byte, error) {
+	// Retrieve the formatters to apply in order
+	fs, ok := f.(Formatters)
+	if !ok {
+		fs = Formatters{formatter(f)}
+	}
+	o := src
+	for _, fm := range fs {
+		// Skip nil formatters
+		if fm == nil {
+			continue
+		}
+		// Format the source code using the formatter
+		r, e := fm.Format(o)
+		// Return the enriched error in case the formatter fails, without builder call if the source code was changed
+		if e != nil {
+			if !bytes.Equal(o, src) {
+				s = nil
+			}
+			return nil, newFormatError(o, s, e)
+		}
+		o = r
+	}
+	// Return the formatted source code
+	return o, nil
+}
+
+// newFormatError returns e as FormatError if e is a scanner.ErrorList. The position of the first error is
+// mapped to the offending lines in src and the builder call recorded in s. Other errors are returned unchanged.
+func newFormatError(src []byte, s spans, e error) error {
+	// Retrieve the list of syntax errors
+	var el scanner.ErrorList
+	if !errors.As(e, &el) || len(el) == 0 {
+		// Return e unchanged if it is not a list of syntax errors
+		return e
+	}
+	// Split the source code into lines
+	lines := strings.Split(string(src), "\n")
+	// Retrieve the position of the first error, clamped to the source code
+	line := min(max(el[0].Pos.Line, 1), len(lines))
+	// Clamp the column to the line, since the formatter shifts the column of the first line of source code fragments
+	col := min(max(el[0].Pos.Column, 1), len(lines[line-1])+1)
+	// Compute the offset of the error position in src
+	off := col - 1
+	for _, l := range lines[:line-1] {
+		off += len(l) + 1
+	}
+	// Create the FormatError
+	fe := &FormatError{Line: line, Column: col, Msg: el[0].Msg, Err: e}
+	// Add the builder call and its call site, if the offset is covered by a recorded span
+	if sp := s.find(off); sp != nil {
+		fe.Op, fe.Caller = sp.op, sp.caller()
+	}
+	// Add the preceding lines, the offending line and the caret
+	var b bytes.Buffer
+	for i := max(line-contextLines, 1); i <= line; i++ {
+		fmt.Fprintf(&b, "%5d | %v\n", i, lines[i-1])
+	}
+	fmt.Fprintf(&b, "%5v | %v^", "", caretIndent(lines[line-1][:col-1]))
+	// Add the following lines without the empty line after the final line break
+	n := len(lines)
+	if n > 1 && lines[n-1] == "" {
+		n--
+	}
+	for i := line + 1; i <= min(line+contextLines, n); i++ {
+		fmt.Fprintf(&b, "\n%5d | %v", i, lines[i-1])
+	}
+	fe.Context = b.String()
+	// Return the FormatError
+	return fe
+}
+
+// caretIndent returns the indentation for a caret below the end of l. Tabs are kept
+// so the caret is aligned with the offending line, all other characters are replaced by spaces.
+func caretIndent(l string) string {
+	// Replace all characters except tabs with spaces
+	return strings.Map(func(r rune) rune {
+		// Keep tabs
+		if r == '\t' {
+			return r
+		}
+		// Replace any other character with a space
+		return ' '
+	}, l)
+}
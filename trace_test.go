@@ -0,0 +1,206 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"errors"  // errors
+	"fmt"     // fmt
+	"strings" // strings
+	"testing" // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestFormatError tests Format to return a FormatError pointing to the builder call which produced
+// the offending source code. The test fails if Format does not return a FormatError or if the
+// FormatError does not contain the expected position, builder call and call site.
+func TestFormatError(t *testing.T) {
+	// Retrieve a function call with a missing parameters ending followed by a block ending
+	c := lpcode.NewCode().SetTrace(true).Call(testCall).Ident(testIdent).Listln().BlockEnd()
+	// Retrieve the error of Format
+	e := c.Format()
+	// The test fails if Format returns nil
+	if e == nil {
+		t.Fatal(tserr.NilFailed("Format"))
+	}
+	// The test fails if the error does not wrap a FormatError
+	var fe *lpcode.FormatError
+	if !errors.As(e, &fe) {
+		t.Fatal(tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: e.Error(), Want: "FormatError"}))
+	}
+	// The test fails if the syntax error is not reported in the second line
+	if fe.Line != 2 {
+		t.Error(tserr.Equal(&tserr.EqualArgs{Var: "Line", Actual: int64(fe.Line), Want: 2}))
+	}
+	// The test fails if the syntax error is not mapped to BlockEnd
+	if fe.Op != "BlockEnd" {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Op", Actual: fe.Op, Want: "BlockEnd"}))
+	}
+	// The test fails if the call site is not in this file
+	if !strings.Contains(fe.Caller, "trace_test.go") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Caller", Actual: fe.Caller, Want: "trace_test.go"}))
+	}
+	// The test fails if the context does not contain the offending line and the caret
+	if !strings.Contains(fe.Context, "| }") || !strings.Contains(fe.Context, "^") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Context", Actual: fe.Context, Want: "offending line and caret"}))
+	}
+}
+
+// TestFormatErrorContext tests Format to return a FormatError with the lines preceding and following the offending line.
+// The test fails if Format does not return a FormatError or if the context differs from the expected context.
+func TestFormatErrorContext(t *testing.T) {
+	// Retrieve source code with a syntax error in the middle
+	c := lpcode.NewCode().Ident("package " + testKey + "\nvar a = 1\nvar = 2\nvar b = 3\nvar c = 4\nvar d = 5\n")
+	// The test fails if the error does not wrap a FormatError
+	var fe *lpcode.FormatError
+	if e := c.Format(); !errors.As(e, &fe) {
+		t.Fatal(tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprint(e), Want: "FormatError"}))
+	}
+	// The test fails if the context differs from the expected context
+	want := "    1 | package " + testKey + "\n    2 | var a = 1\n    3 | var = 2\n      |     ^\n    4 | var b = 3\n    5 | var c = 4"
+	if fe.Context != want {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Context", Actual: fe.Context, Want: want}))
+	}
+}
+
+// TestFormatErrorCaller tests Format to return a FormatError pointing to this file as call site of every builder
+// call, which produces source code, if tracing is enabled. The test fails if Format does not return a FormatError,
+// if the FormatError does not point to the builder call or if the call site is not in this file.
+func TestFormatErrorCaller(t *testing.T) {
+	// Declare the builder calls producing the source code at the end of an unterminated function
+	tcs := []struct {
+		op string
+		f  func(*lpcode.Code)
+	}{
+		{"LineComment", func(c *lpcode.Code) { c.LineComment(testKey) }},
+		{"FuncEnd", func(c *lpcode.Code) { c.Ident("{\n").FuncEnd() }},
+		{"BlockEnd", func(c *lpcode.Code) { c.Ident("{\n").BlockEnd() }},
+		{"Call", func(c *lpcode.Code) { c.Call(testCall) }},
+		{"ParamEndln", func(c *lpcode.Code) { c.ParamEndln() }},
+		{"ParamEnd", func(c *lpcode.Code) { c.ParamEnd() }},
+		{"Func1", func(c *lpcode.Code) {
+			c.Doc(lpcode.NewDoc().Paragraph(testKey)).NoInline().Func1(&lpcode.Func1Args{Name: testKey})
+		}},
+		{"TypeStruct", func(c *lpcode.Code) { c.TypeStruct(testKey) }},
+		{"VarSpec", func(c *lpcode.Code) { c.VarSpec(&lpcode.VarSpecArgs{Ident: testIdent, Type: testType}) }},
+		{"List", func(c *lpcode.Code) { c.List() }},
+		{"Listln", func(c *lpcode.Code) { c.Listln() }},
+		{"SelField", func(c *lpcode.Code) { c.SelField(&lpcode.SelArgs{Val: testIdent, Sel: testKey}) }},
+		{"SelMethod", func(c *lpcode.Code) { c.SelMethod(&lpcode.SelArgs{Val: testIdent, Sel: testKey}) }},
+		{"If", func(c *lpcode.Code) { c.If(&lpcode.IfArgs{ExprLeft: testIdent, ExprRight: testKey, Operator: "=="}) }},
+		{"IfErr", func(c *lpcode.Code) { c.IfErr(&lpcode.IfErrArgs{Method: testCall, Operator: "!="}) }},
+		{"Return", func(c *lpcode.Code) { c.Return() }},
+		{"Addr", func(c *lpcode.Code) { c.Addr() }},
+		{"Ident", func(c *lpcode.Code) { c.Ident(testIdent) }},
+		{"Assignment", func(c *lpcode.Code) { c.Assignment(&lpcode.AssignmentArgs{ExprLeft: testIdent, ExprRight: testKey}) }},
+		{"CompositeLit", func(c *lpcode.Code) { c.CompositeLit(testType) }},
+		{"ShortVarDecl", func(c *lpcode.Code) { c.ShortVarDecl(&lpcode.ShortVarDeclArgs{Ident: testIdent, Expr: testKey}) }},
+		{"KeyedElement", func(c *lpcode.Code) { c.KeyedElement(&lpcode.KeyedElementArgs{Key: testKey, Elem: testElem}) }},
+		{"Testvariables", func(c *lpcode.Code) {
+			c.Testvariables(&lpcode.Testvars{String: 1})
+		}},
+		{"BlockComment", func(c *lpcode.Code) { c.BlockComment(testKey) }},
+		{"EmbedVar", func(c *lpcode.Code) {
+			c.EmbedVar(&lpcode.EmbedVarArgs{Ident: testIdent, Type: lpcode.EmbedString, Patterns: []string{testKey}})
+		}},
+		{"BinaryLit", func(c *lpcode.Code) {
+			c.BinaryLit(&lpcode.BinaryLitArgs{Ident: testIdent, Data: strings.NewReader(testKey)})
+		}},
+		{"Write", func(c *lpcode.Code) { fmt.Fprintf(c, "%v", testIdent) }},
+		{"Ident", func(c *lpcode.Code) {
+			c.Placeholder(testKey)
+			_ = c.Fill(testKey, lpcode.NewCode().SetTrace(true).Ident(testIdent))
+		}},
+		{"Ident", func(c *lpcode.Code) { c.Declare(lpcode.PartFuncs, lpcode.NewCode().SetTrace(true).Ident(testIdent)) }},
+	}
+	for _, tc := range tcs {
+		// Retrieve the builder call at the end of an unterminated function
+		c := lpcode.NewCode().SetTrace(true).Ident("package " + testKey + "\n\nfunc f() {\n")
+		tc.f(c)
+		// The test fails if the error does not wrap a FormatError
+		var fe *lpcode.FormatError
+		if e := c.Format(); !errors.As(e, &fe) {
+			t.Fatal(tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprint(e), Want: "FormatError"}))
+		}
+		// The test fails if the syntax error is not mapped to the builder call or the call site is not in this file
+		if fe.Op != tc.op {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Op", Actual: fe.Op, Want: tc.op}))
+		}
+		if !strings.Contains(fe.Caller, "trace_test.go") {
+			t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: tc.op, Actual: fe.Caller, Want: "trace_test.go"}))
+		}
+	}
+}
+
+// TestFormatErrorCodefile tests FinishFile of a Codefile to return a FormatError pointing to this file as call site of
+// source code written with WriteCode, if tracing is enabled. The test fails if FinishFile does not return a FormatError
+// or if the call site is not in this file.
+func TestFormatErrorCodefile(t *testing.T) {
+	// Retrieve a Codefile with tracing enabled
+	cf := newCodefile(t)
+	if e := cf.SetTrace(true); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetTrace", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// Write an unterminated function with WriteCode
+	if e := cf.StartFile(); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "StartFile", Fn: string(cf.Filepath()), Err: e}))
+	}
+	if e := cf.WriteCode(strings.NewReader("func " + testKey + "() {\n")); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteCode", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// The test fails if the error does not wrap a FormatError
+	var fe *lpcode.FormatError
+	if e := cf.FinishFile(); !errors.As(e, &fe) {
+		t.Fatal(tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprint(e), Want: "FormatError"}))
+	}
+	// The test fails if the call site is not in this file
+	if !strings.Contains(fe.Caller, "trace_test.go") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Caller", Actual: fe.Caller, Want: "trace_test.go"}))
+	}
+}
+
+// TestFormatErrorGenerate tests Generate of a Codefile to return a FormatError pointing to the builder call in the
+// generator function, if tracing is enabled. The test fails if Generate does not return a FormatError, if the error is
+// not mapped to the builder call or if the call site is not in this file.
+func TestFormatErrorGenerate(t *testing.T) {
+	// Retrieve a Codefile with tracing enabled
+	cf := newCodefile(t)
+	if e := cf.SetTrace(true); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "SetTrace", Fn: string(cf.Filepath()), Err: e}))
+	}
+	// Generate a variable declaration without identifier
+	e := cf.Generate(func(c *lpcode.Code) error {
+		c.Ident("var = 1\n")
+		return nil
+	})
+	// The test fails if the error does not wrap a FormatError
+	var fe *lpcode.FormatError
+	if !errors.As(e, &fe) {
+		t.Fatal(tserr.TypeNotMatching(&tserr.TypeNotMatchingArgs{Actual: fmt.Sprint(e), Want: "FormatError"}))
+	}
+	// The test fails if the error is not mapped to the builder call or the call site is not in this file
+	if fe.Op != "Ident" {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Op", Actual: fe.Op, Want: "Ident"}))
+	}
+	if !strings.Contains(fe.Caller, "trace_test.go") {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Caller", Actual: fe.Caller, Want: "trace_test.go"}))
+	}
+}
+
+// TestFormatErrorNil tests Error and Unwrap of FormatError in case *FormatError is nil.
+// The test fails if Error does not return an empty string or Unwrap does not return nil.
+func TestFormatErrorNil(t *testing.T) {
+	// Declare fe as type *FormatError and assign nil
+	var fe *lpcode.FormatError = nil
+	// The test fails if Error does not return an empty string
+	if fe.Error() != "" {
+		t.Error(tserr.NotEmpty("Error"))
+	}
+	// The test fails if Unwrap does not return nil
+	if fe.Unwrap() != nil {
+		t.Error(tserr.NotNil("Unwrap"))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode
+
+// Import Go standard library packages, tserr and tsfio
+import (
+	"bytes"         // bytes
+	"errors"        // errors
+	"fmt"           // fmt
+	"go/ast"        // ast
+	"go/build"      // build
+	"go/importer"   // importer
+	"go/parser"     // parser
+	"go/token"      // token
+	"go/types"      // types
+	"io"            // io
+	"path/filepath" // filepath
+	"strings"       // strings
+
+	"github.com/thorstenrie/tserr" // tserr
+	"github.com/thorstenrie/tsfio" // tsfio
+)
+
+// VerifyArgs contains the configuration for type checking generated source code with Verify.
+type VerifyArgs struct {
+	// Dir is the directory of the package the generated source code belongs to. The Go source files
+	// in Dir with the same package name are type checked together with the generated source code,
+	// so that the generated source code may refer to their declarations. If Dir is empty,
+	// the generated source code is type checked on its own.
+	Dir string
+	// Filename is the name of the generated source file in Dir. A source file in Dir with the same name
+	// is replaced by the generated source code. If Filename is empty, "generated.go" is used.
+	Filename string
+	// Importer imports the packages imported by the generated source code. If Importer is nil,
+	// packages are imported from source, which does not require network access.
+	Importer types.Importer
+}
+
+// Diagnostic is an error found by type checking generated source code.
+type Diagnostic struct {
+	Pos  token.Position // position of the error
+	Msg  string         // error message
+	Soft bool           // true, if the error does not prevent a valid package, like an unused variable
+}
+
+// String returns the diagnostic as filename:line:column: message.
+func (d Diagnostic) String() string {
+	// Return the diagnostic
+	return fmt.Sprintf("%v: %v", d.Pos, d.Msg)
+}
+
+// Diagnostics is returned by Verify in case type checking generated source code fails.
+// It contains all errors found by the type checker in order.
+type Diagnostics []Diagnostic
+
+// Error returns all diagnostics, one per line.
+func (d Diagnostics) Error() string {
+	// Retrieve each diagnostic as string
+	s := make([]string, len(d))
+	for i := range d {
+		s[i] = d[i].String()
+	}
+	// Return the diagnostics, one per line
+	return strings.Join(s, "\n")
+}
+
+// Verify type checks the source code in code with go/types. The source code must be a complete
+// Go source file including the package clause. The type check is configured by a, which may be nil.
+// Verify returns nil, if the type check succeeds. If the type checker reports errors, it returns
+// Diagnostics. It returns other errors, if code is nil or if the source code cannot be parsed.
+func (code *Code) Verify(a *VerifyArgs) error {
+	// Return an error in case code is nil
+	if code == nil {
+		return tserr.NilPtr()
+	}
+	// Type check the source code with the Go source files on disk
+	return verify(DiskFS{}, code.canonical().b.Bytes(), a)
+}
+
+// verify type checks src configured by a, which may be nil. The Go source files of the package are read from fsys.
+func verify(fsys FS, src []byte, a *VerifyArgs) error {
+	// Use the default configuration, if a is nil
+	if a == nil {
+		a = &VerifyArgs{}
+	}
+	// Retrieve the filename of the generated source code
+	fn := a.Filename
+	if fn == "" {
+		fn = "generated.go"
+	}
+	// Retrieve the path of the generated source code. The directory is used by the importer
+	// to resolve imports relative to the module on disk.
+	base := fn
+	if a.Dir != "" {
+		d, e := filepath.Abs(a.Dir)
+		if e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "Abs", Fn: a.Dir, Err: e})
+		}
+		fn = filepath.Join(d, fn)
+	}
+	// Parse the generated source code
+	fset := token.NewFileSet()
+	f, e := parser.ParseFile(fset, fn, src, parser.ParseComments)
+	if e != nil {
+		return tserr.Op(&tserr.OpArgs{Op: "parse", Fn: fn, Err: e})
+	}
+	files := []*ast.File{f}
+	// Parse the Go source files of the package in Dir
+	if a.Dir != "" {
+		p, e := packageFiles(fsys, fset, a.Dir, base, f.Name.Name)
+		if e != nil {
+			return tserr.Op(&tserr.OpArgs{Op: "parse package", Fn: a.Dir, Err: e})
+		}
+		files = append(files, p...)
+	}
+	// Retrieve the importer
+	imp := a.Importer
+	if imp == nil {
+		imp = importer.ForCompiler(fset, "source", nil)
+	}
+	// Type check the files and collect all errors
+	var d Diagnostics
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			var te types.Error
+			if errors.As(err, &te) {
+				d = append(d, Diagnostic{Pos: te.Fset.Position(te.Pos), Msg: te.Msg, Soft: te.Soft})
+			} else {
+				d = append(d, Diagnostic{Msg: err.Error()})
+			}
+		},
+	}
+	conf.Check(f.Name.Name, fset, files, nil)
+	// Return the diagnostics, if any
+	if len(d) > 0 {
+		return d
+	}
+	// Return nil
+	return nil
+}
+
+// packageFiles parses the Go source files in directory dn of fsys with package name pkg, except file fn.
+// Files excluded by build constraints are skipped. Test files are only included, if fn is a test file.
+// The files are parsed with their absolute paths, so that they match the path of the generated source code.
+func packageFiles(fsys FS, fset *token.FileSet, dn, fn, pkg string) ([]*ast.File, error) {
+	// Retrieve the absolute path of the directory
+	d, e := filepath.Abs(dn)
+	if e != nil {
+		return nil, e
+	}
+	// List the files in the directory
+	fns, e := fsys.ListFiles(tsfio.Directory(dn))
+	if e != nil {
+		return nil, e
+	}
+	// Match build constraints against the files in fsys
+	ctx := build.Default
+	ctx.OpenFile = func(p string) (io.ReadCloser, error) {
+		b, e := fsys.ReadFile(tsfio.Filename(p))
+		if e != nil {
+			return nil, e
+		}
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	var files []*ast.File
+	for _, p := range fns {
+		n := filepath.Base(string(p))
+		// Skip non Go files, the generated file and test files of non test files
+		if !strings.HasSuffix(n, ".go") || n == fn || (strings.HasSuffix(n, "_test.go") && !strings.HasSuffix(fn, "_test.go")) {
+			continue
+		}
+		// Skip files excluded by build constraints
+		if ok, e := ctx.MatchFile(dn, n); e != nil || !ok {
+			continue
+		}
+		// Read and parse the file
+		b, e := fsys.ReadFile(p)
+		if e != nil {
+			return nil, e
+		}
+		f, e := parser.ParseFile(fset, filepath.Join(d, n), b, parser.ParseComments)
+		if e != nil {
+			return nil, e
+		}
+		// Add the file, if it belongs to the package
+		if f.Name.Name == pkg {
+			files = append(files, f)
+		}
+	}
+	// Return the parsed files
+	return files, nil
+}
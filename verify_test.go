@@ -0,0 +1,75 @@
+// Copyright (c) 2023 thorstenrie.
+// All Rights Reserved. Use is governed with GNU Affero General Public License v3.0
+// that can be found in the LICENSE file.
+package lpcode_test
+
+// Import Go standard library packages as well as lpcode and tserr
+import (
+	"errors"        // errors
+	"os"            // os
+	"path/filepath" // filepath
+	"testing"       // testing
+
+	"github.com/thorstenrie/lpcode" // lpcode
+	"github.com/thorstenrie/tserr"  // tserr
+)
+
+// TestVerify tests Verify to type check source code importing a std library package.
+// The test fails if Verify returns an error.
+func TestVerify(t *testing.T) {
+	// Retrieve source code importing strings
+	c := lpcode.NewCode().Ident("package mirkwood\n\nimport \"strings\"\n\n")
+	c.Func1(&lpcode.Func1Args{Name: testCall, Var: testIdent, Type: "string", Return: "string"})
+	c.Return().SelMethod(&lpcode.SelArgs{Val: "strings", Sel: "ToUpper"}).Ident(testIdent).ParamEndln().FuncEnd()
+	// The test fails if Verify returns an error
+	if e := c.Verify(nil); e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Verify", Fn: "code", Err: e}))
+	}
+}
+
+// TestVerifyDiagnostics tests Verify to return Diagnostics for an undefined name.
+// The test fails if Verify does not return Diagnostics with one diagnostic in line 4.
+func TestVerifyDiagnostics(t *testing.T) {
+	// Retrieve source code returning an undefined name
+	c := lpcode.NewCode().Ident("package mirkwood\n\n")
+	c.Func1(&lpcode.Func1Args{Name: testCall, Var: testIdent, Type: testType, Return: testType})
+	c.Return().Ident(testKey).Ident("\n").FuncEnd()
+	// The test fails if Verify does not return Diagnostics
+	var d lpcode.Diagnostics
+	if e := c.Verify(nil); !errors.As(e, &d) {
+		t.Fatal(tserr.NilFailed("Verify"))
+	}
+	// The test fails if the diagnostic does not point to the undefined name
+	if len(d) != 1 || d[0].Pos.Line != 4 {
+		t.Error(tserr.EqualStr(&tserr.EqualStrArgs{Var: "Diagnostics", Actual: d.Error(), Want: "undefined: " + testKey + " in line 4"}))
+	}
+}
+
+// TestVerifyDir tests Verify to type check source code together with the Go source files in the
+// package directory. The test fails if Verify returns an error.
+func TestVerifyDir(t *testing.T) {
+	// Create a temporary package directory with a source file declaring testKey
+	d := t.TempDir()
+	if e := os.WriteFile(filepath.Join(d, "decl.go"), []byte("package mirkwood\n\nvar "+testKey+" "+testType+"\n"), 0644); e != nil {
+		t.Fatal(tserr.Op(&tserr.OpArgs{Op: "WriteFile", Fn: d, Err: e}))
+	}
+	// Retrieve source code returning testKey
+	c := lpcode.NewCode().Ident("package mirkwood\n\n")
+	c.Func1(&lpcode.Func1Args{Name: testCall, Var: testIdent, Type: testType, Return: testType})
+	c.Return().Ident(testKey).Ident("\n").FuncEnd()
+	// The test fails if Verify returns an error
+	if e := c.Verify(&lpcode.VerifyArgs{Dir: d}); e != nil {
+		t.Error(tserr.Op(&tserr.OpArgs{Op: "Verify", Fn: d, Err: e}))
+	}
+}
+
+// TestVerifyNil tests Verify to return an error in case
+// *Code is nil. The test fails if Verify does not return an error.
+func TestVerifyNil(t *testing.T) {
+	// Declare c as type *Code and assign nil
+	var c *lpcode.Code = nil
+	// The test fails if Verify does not return an error.
+	if e := c.Verify(nil); e == nil {
+		t.Error(tserr.NilFailed("Verify"))
+	}
+}